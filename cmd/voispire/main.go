@@ -6,6 +6,10 @@ import (
 	"strings"
 
 	"github.com/but80/voispire"
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/denoise"
+	"github.com/but80/voispire/internal/formant"
+	"github.com/but80/voispire/internal/series"
 	"github.com/comail/colog"
 	"github.com/urfave/cli"
 	"golang.org/x/xerrors"
@@ -26,10 +30,149 @@ var commonFlags = []cli.Flag{
 		Name:  "formant, f",
 		Usage: "フォルマントシフト量 [半音]",
 	},
+	cli.Float64Flag{
+		Name:  "tilt",
+		Usage: "スペクトルの傾き [dB/oct]（1kHz を中心に、正の値で明るい声、負の値で暗い声）",
+	},
+	cli.StringFlag{
+		Name:  "warp",
+		Usage: "フォルマントシフトの周波数軸の伸縮方法（linear, bilinear, または \"周波数[Hz]:重み\" のカンマ区切り。例: 3000:1,6000:0）",
+		Value: "linear",
+	},
 	cli.IntFlag{
 		Name:  "rate, r",
 		Usage: "ファイル出力サンプリング周波数（省略時は入力と同じ）",
 	},
+	cli.Float64Flag{
+		Name:  "transpose, t",
+		Usage: "ピッチシフト量 [半音]（start では --pitch-engine vocoder または --carrier 指定時のみ）",
+	},
+	cli.StringFlag{
+		Name:  "pitch-engine",
+		Usage: "ピッチシフトの方式（sinc: 周期間のsinc補間, psola: TD-PSOLA, vocoder: 位相ボコーダ）",
+		Value: "sinc",
+	},
+	cli.IntFlag{
+		Name:  "fft-size",
+		Usage: "フォルマントシフト等に用いるFFTのサイズ（2の累乗）",
+		Value: 1024,
+	},
+	cli.IntFlag{
+		Name:  "fft-overlap",
+		Usage: "FFTのフレームの重なりの数（2, 4, 8）。大きいほど高品質で処理が重くなる",
+		Value: 2,
+	},
+	cli.StringFlag{
+		Name:  "fft-window",
+		Usage: "FFTの窓関数（" + strings.Join(series.WindowNames(), ", ") + "）",
+		Value: "sqrthann",
+	},
+	cli.StringFlag{
+		Name:  "envelope",
+		Usage: "包絡線の推定方法（cepstrum: ケプストラム分析, lpc: 線形予測分析）",
+		Value: "cepstrum",
+	},
+	cli.IntFlag{
+		Name:  "envelope-iterations",
+		Usage: "包絡線の推定を繰り返す回数。少ないほど処理が軽くなる",
+		Value: 16,
+	},
+	cli.StringFlag{
+		Name:  "envelope-smoothing",
+		Usage: "包絡線の時間方向の平滑化の方法（none, exp: 指数平滑化, median: メディアン）。cepstrum のみ",
+		Value: "none",
+	},
+	cli.Float64Flag{
+		Name:  "envelope-tau",
+		Usage: "包絡線の平滑化の時定数 [msec]",
+		Value: 20.0,
+	},
+	cli.StringFlag{
+		Name:  "low-flatten",
+		Usage: "包絡線を平坦化する低域（off: 平坦化しない, f0: 基本周波数未満, 数値: 指定した周波数 [Hz] 未満）",
+		Value: "off",
+	},
+	cli.Float64Flag{
+		Name:  "transients",
+		Usage: "過渡音（破裂音等）を加工せずに残すオンセットのスペクトルフラックスの閾値（例: 1、省略時は使用しない）",
+	},
+	cli.StringFlag{
+		Name:  "carrier",
+		Usage: "チャンネルボコーダの搬送波（saw: のこぎり波, square: 矩形波, noise: 白色雑音, または音声ファイル。省略時は使用しない）",
+	},
+	cli.Float64Flag{
+		Name:  "carrier-freq",
+		Usage: "搬送波の発振器の周波数 [Hz]（-t のピッチシフト量やMIDIのノートに従って変化）",
+		Value: 110.0,
+	},
+	cli.BoolFlag{
+		Name:  "whisper",
+		Usage: "声帯の振動による音源を雑音に置き換え、ささやき声にする",
+	},
+	cli.StringFlag{
+		Name:  "denoise",
+		Usage: "変換前の雑音除去の方法（off, subtract: スペクトル減算, wiener: Wienerフィルタ）",
+		Value: "off",
+	},
+	cli.Float64Flag{
+		Name:  "denoise-amount",
+		Usage: "雑音除去の強さ（雑音のパワースペクトルにかける倍率）",
+		Value: 1.0,
+	},
+	cli.Float64Flag{
+		Name:  "denoise-floor",
+		Usage: "雑音除去で各周波数を減衰させる下限 [dB]",
+		Value: -20.0,
+	},
+	cli.StringFlag{
+		Name:  "noise-profile",
+		Usage: "雑音のみを録音した音声ファイル（省略時は入力の先頭から雑音を学習）",
+	},
+	cli.Float64Flag{
+		Name:  "noise-learn",
+		Usage: "雑音を学習する入力の先頭の長さ [msec]（この間は無音にしておく）",
+		Value: 500.0,
+	},
+	cli.Float64Flag{
+		Name:  "aec-tail",
+		Usage: "エコーキャンセラで除去するエコーの長さ [msec]（長いほど処理が重くなる）",
+		Value: 100.0,
+	},
+	cli.StringFlag{
+		Name:  "midi",
+		Usage: "パラメータ操作に用いるMIDI入力ポート（/dev/snd/midiC1D0 等）またはMIDIファイル（ノートによるピッチ操作は --pitch-engine vocoder では無効）",
+	},
+	cli.Float64Flag{
+		Name:  "mix, m",
+		Usage: "変換後の音声の比率 0..1（残りは変換前の音声）",
+		Value: 1.0,
+	},
+	cli.Float64Flag{
+		Name:  "gain, g",
+		Usage: "出力ゲイン [dB]",
+	},
+	cli.BoolFlag{
+		Name:  "limit, l",
+		Usage: "出力にソフトリミッタを使用",
+	},
+	cli.Float64Flag{
+		Name:  "gate",
+		Usage: "ノイズゲートの閾値 [dBFS]（例: -50、省略時はノイズゲートを使用しない）",
+	},
+	cli.Float64Flag{
+		Name:  "gate-attack",
+		Usage: "ノイズゲートのアタック時間 [msec]",
+		Value: 5.0,
+	},
+	cli.Float64Flag{
+		Name:  "gate-release",
+		Usage: "ノイズゲートのリリース時間 [msec]",
+		Value: 100.0,
+	},
+	cli.BoolFlag{
+		Name:  "gate-voicing",
+		Usage: "有声と判定された区間のみノイズゲートを開く",
+	},
 	cli.BoolFlag{
 		Name:  "verbose, v",
 		Usage: "詳細を表示",
@@ -40,6 +183,67 @@ var commonFlags = []cli.Flag{
 	},
 }
 
+// parseFloatList は、カンマ区切りの数値リストを解析します。
+func parseFloatList(s string) ([]float64, error) {
+	result := []float64{}
+	if strings.TrimSpace(s) == "" {
+		return result, nil
+	}
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// parseHarmonyFlags は、ハーモニーの声部に関するフラグを解析します。
+func parseHarmonyFlags(ctx *cli.Context) ([]voispire.Voice, error) {
+	intervals, err := parseFloatList(ctx.String("harmony"))
+	if err != nil {
+		return nil, xerrors.Errorf("ハーモニーの音程は数値のカンマ区切りである必要があります: %w", err)
+	}
+	gains, err := parseFloatList(ctx.String("harmony-gain"))
+	if err != nil {
+		return nil, xerrors.Errorf("ハーモニーの音量は数値のカンマ区切りである必要があります: %w", err)
+	}
+	pans, err := parseFloatList(ctx.String("harmony-pan"))
+	if err != nil {
+		return nil, xerrors.Errorf("ハーモニーの定位は数値のカンマ区切りである必要があります: %w", err)
+	}
+	formants, err := parseFloatList(ctx.String("harmony-formant"))
+	if err != nil {
+		return nil, xerrors.Errorf("ハーモニーのフォルマントシフト量は数値のカンマ区切りである必要があります: %w", err)
+	}
+	if len(intervals) < len(gains) || len(intervals) < len(pans) || len(intervals) < len(formants) {
+		return nil, xerrors.New("ハーモニーの音量・定位・フォルマントシフト量の個数が音程の個数を超えています")
+	}
+
+	voices := make([]voispire.Voice, len(intervals))
+	for i, v := range intervals {
+		if v < -24.0 || 24.0 < v {
+			return nil, xerrors.New("ハーモニーの音程は -24..24 の数値である必要があります")
+		}
+		voices[i].Interval = v
+		voices[i].Gain = -6.0
+		if i < len(gains) {
+			voices[i].Gain = gains[i]
+		}
+		if i < len(pans) {
+			if pans[i] < -1.0 || 1.0 < pans[i] {
+				return nil, xerrors.New("ハーモニーの定位は -1..1 の数値である必要があります")
+			}
+			voices[i].Pan = pans[i]
+		}
+		if i < len(formants) {
+			voices[i].Formant = formants[i]
+		}
+	}
+	return voices, nil
+}
+
 func parseFlags(ctx *cli.Context) (voispire.Options, error) {
 	if ctx.Bool("debug") {
 		colog.SetMinLevel(colog.LDebug)
@@ -56,6 +260,11 @@ func parseFlags(ctx *cli.Context) (voispire.Options, error) {
 		err := xerrors.New("フォルマントシフト量は -12..12 の数値である必要があります")
 		return o, cli.NewExitError(err, 1)
 	}
+	o.Tilt = ctx.Float64("tilt")
+	if o.Tilt < -12.0 || 12.0 < o.Tilt {
+		err := xerrors.New("スペクトルの傾きは -12..12 の数値である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
 
 	o.Transpose = ctx.Float64("transpose")
 	if o.Transpose < -12.0 || 12.0 < o.Transpose {
@@ -63,12 +272,155 @@ func parseFlags(ctx *cli.Context) (voispire.Options, error) {
 		return o, cli.NewExitError(err, 1)
 	}
 
+	o.Warp = ctx.String("warp")
+	if _, err := formant.ParseWarp(o.Warp); err != nil {
+		err := xerrors.Errorf("周波数軸の伸縮方法は linear, bilinear, または \"周波数[Hz]:重み\" のカンマ区切りである必要があります: %w", err)
+		return o, cli.NewExitError(err, 1)
+	}
+
+	o.PitchEngine = ctx.String("pitch-engine")
+	if o.PitchEngine != "sinc" && o.PitchEngine != "psola" && o.PitchEngine != "vocoder" {
+		err := xerrors.New("ピッチシフトの方式は sinc, psola, vocoder のいずれかである必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+
 	o.FramePeriodMsec = ctx.Float64("frame-period")
 	if o.FramePeriodMsec != 0 && (o.FramePeriodMsec < 1.0 || 200.0 < o.FramePeriodMsec) {
 		err := xerrors.New("フレームピリオドは 1..200 の数値である必要があります")
 		return o, cli.NewExitError(err, 1)
 	}
 
+	o.FFTSize = ctx.Int("fft-size")
+	if o.FFTSize < 256 || 8192 < o.FFTSize || o.FFTSize&(o.FFTSize-1) != 0 {
+		err := xerrors.New("FFTのサイズは 256..8192 の2の累乗である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+	o.FFTOverlap = ctx.Int("fft-overlap")
+	if o.FFTOverlap != 2 && o.FFTOverlap != 4 && o.FFTOverlap != 8 {
+		err := xerrors.New("FFTのフレームの重なりの数は 2, 4, 8 のいずれかである必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+	o.FFTWindow = ctx.String("fft-window")
+	if _, err := series.Named(o.FFTWindow, o.FFTSize); err != nil {
+		err := xerrors.Errorf("FFTの窓関数は %s のいずれかである必要があります", strings.Join(series.WindowNames(), ", "))
+		return o, cli.NewExitError(err, 1)
+	}
+
+	o.Envelope = ctx.String("envelope")
+	if o.Envelope != formant.EnvelopeCepstrum && o.Envelope != formant.EnvelopeLPC {
+		err := xerrors.New("包絡線の推定方法は cepstrum, lpc のいずれかである必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+
+	o.EnvelopeIterations = ctx.Int("envelope-iterations")
+	if o.EnvelopeIterations < 1 || 64 < o.EnvelopeIterations {
+		err := xerrors.New("包絡線の推定を繰り返す回数は 1..64 の数値である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+
+	o.Smoothing = ctx.String("envelope-smoothing")
+	if o.Smoothing != formant.SmoothingNone && o.Smoothing != formant.SmoothingExp && o.Smoothing != formant.SmoothingMedian {
+		err := xerrors.New("包絡線の平滑化の方法は none, exp, median のいずれかである必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+	o.SmoothingTauMsec = ctx.Float64("envelope-tau")
+	if o.SmoothingTauMsec < 1.0 || 1000.0 < o.SmoothingTauMsec {
+		err := xerrors.New("包絡線の平滑化の時定数は 1..1000 の数値である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+
+	switch lf := ctx.String("low-flatten"); lf {
+	case "off":
+	case "f0":
+		o.LowCutoffF0 = true
+	default:
+		v, err := strconv.ParseFloat(lf, 64)
+		if err != nil || v < 20.0 || 1000.0 < v {
+			err := xerrors.New("包絡線を平坦化する低域は off, f0, または 20..1000 の数値である必要があります")
+			return o, cli.NewExitError(err, 1)
+		}
+		o.LowCutoff = v
+	}
+
+	o.Transients = ctx.Float64("transients")
+	if o.Transients < 0 || 100.0 < o.Transients {
+		err := xerrors.New("過渡音のオンセットの閾値は 0..100 の数値である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+
+	o.Carrier = ctx.String("carrier")
+	o.CarrierFreq = ctx.Float64("carrier-freq")
+	if o.CarrierFreq < 20.0 || 2000.0 < o.CarrierFreq {
+		err := xerrors.New("搬送波の周波数は 20..2000 の数値である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+	if o.Carrier != "" && o.PitchEngine == "vocoder" {
+		err := xerrors.New("チャンネルボコーダは位相ボコーダと同時に使用できません")
+		return o, cli.NewExitError(err, 1)
+	}
+
+	o.Whisper = ctx.Bool("whisper")
+	if o.Whisper && (o.Carrier != "" || o.PitchEngine == "vocoder") {
+		err := xerrors.New("ささやき声はチャンネルボコーダ・位相ボコーダと同時に使用できません")
+		return o, cli.NewExitError(err, 1)
+	}
+
+	switch dn := ctx.String("denoise"); dn {
+	case "off":
+	case denoise.MethodSubtract, denoise.MethodWiener:
+		o.Denoise = dn
+	default:
+		err := xerrors.New("雑音除去の方法は off, subtract, wiener のいずれかである必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+	o.DenoiseAmount = ctx.Float64("denoise-amount")
+	o.DenoiseFloor = ctx.Float64("denoise-floor")
+	if o.DenoiseAmount < .1 || 10.0 < o.DenoiseAmount || o.DenoiseFloor < -80.0 || 0 < o.DenoiseFloor {
+		err := xerrors.New("雑音除去の強さは 0.1..10、減衰の下限は -80..0 の数値である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+	o.NoiseProfile = ctx.String("noise-profile")
+	o.NoiseLearnMsec = ctx.Float64("noise-learn")
+	if o.NoiseLearnMsec < 50.0 || 10000.0 < o.NoiseLearnMsec {
+		err := xerrors.New("雑音を学習する長さは 50..10000 の数値である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+
+	o.EchoTailMsec = ctx.Float64("aec-tail")
+	if o.EchoTailMsec < 1.0 || 1000.0 < o.EchoTailMsec {
+		err := xerrors.New("エコーの長さは 1..1000 の数値である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+
+	o.MIDIPort = ctx.String("midi")
+
+	o.Mix = ctx.Float64("mix")
+	if o.Mix < 0 || 1.0 < o.Mix {
+		err := xerrors.New("ミックス比率は 0..1 の数値である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+
+	o.Gain = ctx.Float64("gain")
+	if o.Gain < -60.0 || 24.0 < o.Gain {
+		err := xerrors.New("出力ゲインは -60..24 の数値である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+
+	o.Limit = ctx.Bool("limit")
+
+	o.GateThreshold = ctx.Float64("gate")
+	if o.GateThreshold < -100.0 || 0 < o.GateThreshold {
+		err := xerrors.New("ノイズゲートの閾値は -100..0 の数値である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+	o.GateAttackMsec = ctx.Float64("gate-attack")
+	o.GateReleaseMsec = ctx.Float64("gate-release")
+	if o.GateAttackMsec < 0 || 1000.0 < o.GateAttackMsec || o.GateReleaseMsec < 0 || 5000.0 < o.GateReleaseMsec {
+		err := xerrors.New("ノイズゲートのアタック時間は 0..1000、リリース時間は 0..5000 の数値である必要があります")
+		return o, cli.NewExitError(err, 1)
+	}
+	o.GateVoicing = ctx.Bool("gate-voicing")
+
 	o.Rate = ctx.Int("rate")
 	if o.Rate != 0 && (o.Rate < 8000 || 96000 < o.Rate) {
 		err := xerrors.New("サンプリング周波数は 8000..96000 の数値である必要があります")
@@ -105,12 +457,38 @@ var startCmd = cli.Command{
 	Aliases:   []string{"s"},
 	Usage:     "ストリーミングを開始します",
 	ArgsUsage: "[ <input-device> [ <output-device> [ <output-file> ] ] ]",
-	Flags:     commonFlags,
+	Flags: append(
+		commonFlags,
+		cli.BoolFlag{
+			Name:  "interactive, i",
+			Usage: "標準入力から \"formant 3\" のような形式でパラメータを変更可能にする",
+		},
+		cli.StringFlag{
+			Name:  "control",
+			Usage: "パラメータ変更を受け付けるTCPアドレス（例: localhost:9000）",
+		},
+		cli.StringFlag{
+			Name:  "osc",
+			Usage: "パラメータ変更を受け付けるOSCのUDPアドレス（例: :9001）",
+		},
+		cli.BoolFlag{
+			Name:  "aec",
+			Usage: "出力した音声を参照して、スピーカーから入力に回り込んだエコーを除去する",
+		},
+	),
 	Action: func(ctx *cli.Context) error {
 		o, err := parseFlags(ctx)
 		if err != nil {
 			return err
 		}
+		if o.Transpose != 0 && o.PitchEngine != "vocoder" && o.Carrier == "" {
+			err := xerrors.New("ストリーミング中のピッチシフトには --pitch-engine vocoder または --carrier を指定する必要があります")
+			return cli.NewExitError(err, 1)
+		}
+		o.ControlStdin = ctx.Bool("interactive")
+		o.ControlAddr = ctx.String("control")
+		o.OSCAddr = ctx.String("osc")
+		o.EchoCancel = ctx.Bool("aec")
 		if 1 <= ctx.NArg() {
 			o.InDevID, _ = strconv.Atoi(ctx.Args()[0])
 		}
@@ -134,15 +512,75 @@ var convertCmd = cli.Command{
 	ArgsUsage: "<input-file> [ <output-file> ]",
 	Flags: append(
 		commonFlags,
-		cli.Float64Flag{
-			Name:  "transpose, t",
-			Usage: "ピッチシフト量 [半音]",
-		},
 		cli.Float64Flag{
 			Name:  "frame-period, p",
 			Usage: "フレームピリオド [msec]",
 			Value: 5.0,
 		},
+		cli.StringFlag{
+			Name:  "pitch-marks",
+			Usage: "ピッチシフト時の周期の区切り方（epoch: 声門閉鎖時刻に合わせる, phase: 基本周波数の位相のみ）",
+			Value: "epoch",
+		},
+		cli.StringFlag{
+			Name:  "harmony",
+			Usage: "ハーモニーとして追加する声部の音程 [半音] のカンマ区切り（例: 4,7）。指定時はステレオで出力",
+		},
+		cli.StringFlag{
+			Name:  "harmony-gain",
+			Usage: "追加する各声部の音量 [dB] のカンマ区切り（省略時は -6）",
+		},
+		cli.StringFlag{
+			Name:  "harmony-pan",
+			Usage: "追加する各声部の定位 -1..1 のカンマ区切り（省略時は 0）",
+		},
+		cli.StringFlag{
+			Name:  "harmony-formant",
+			Usage: "追加する各声部の主声部からのフォルマントシフト量 [半音] のカンマ区切り（省略時は 0）",
+		},
+		cli.StringFlag{
+			Name:  "target-voice",
+			Usage: "声質を近づける目標の話者の音声ファイル",
+		},
+		cli.Float64Flag{
+			Name:  "monotone",
+			Usage: "入力の抑揚によらず一定とする基本周波数 [Hz]（ロボットボイス。-t でさらにピッチシフト可能）",
+		},
+		cli.Float64Flag{
+			Name:  "intonation",
+			Usage: "平均の基本周波数を中心とした抑揚の幅の倍率（0.5: 平坦に, 1.5: 大げさに）",
+			Value: 1.0,
+		},
+		cli.Float64Flag{
+			Name:  "vibrato-depth",
+			Usage: "加えるビブラートの深さ [cent]（省略時はビブラートを加えない）",
+		},
+		cli.Float64Flag{
+			Name:  "vibrato-rate",
+			Usage: "加えるビブラートの速さ [Hz]",
+			Value: 5.5,
+		},
+		cli.Float64Flag{
+			Name:  "vibrato-delay",
+			Usage: "有声区間の開始からビブラートを始めるまでの時間 [msec]",
+			Value: 300.0,
+		},
+		cli.Float64Flag{
+			Name:  "vibrato-reduce",
+			Usage: "入力のビブラートを抑える割合 0..1（基本周波数の軌跡を平滑化）",
+		},
+		cli.Float64Flag{
+			Name:  "jitter",
+			Usage: "5msごとに変える基本周波数の揺らぎの大きさ [%]（がらがら声）",
+		},
+		cli.Float64Flag{
+			Name:  "shimmer",
+			Usage: "5msごとに変える振幅の揺らぎの大きさ [dB]（がらがら声）",
+		},
+		cli.StringFlag{
+			Name:  "aec-reference",
+			Usage: "入力の録音中にスピーカーから再生していた音声ファイル（指定時は入力からそのエコーを除去）",
+		},
 	),
 	Action: func(ctx *cli.Context) error {
 		o, err := parseFlags(ctx)
@@ -154,6 +592,65 @@ var convertCmd = cli.Command{
 			cli.ShowCommandHelpAndExit(ctx, "convert", 1)
 		}
 
+		o.PitchMarks = ctx.String("pitch-marks")
+		if o.PitchMarks != "epoch" && o.PitchMarks != "phase" {
+			err := xerrors.New("周期の区切り方は epoch, phase のいずれかである必要があります")
+			return cli.NewExitError(err, 1)
+		}
+
+		o.Harmony, err = parseHarmonyFlags(ctx)
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		if 0 < len(o.Harmony) && o.PitchEngine == "vocoder" {
+			err := xerrors.New("ハーモニーは位相ボコーダと同時に使用できません")
+			return cli.NewExitError(err, 1)
+		}
+
+		intonation := ctx.Float64("intonation")
+		if intonation < 0 || 3.0 < intonation {
+			err := xerrors.New("抑揚の幅の倍率は 0..3 の数値である必要があります")
+			return cli.NewExitError(err, 1)
+		}
+		o.IntonationOffset = intonation - 1
+
+		o.VibratoDepth = ctx.Float64("vibrato-depth")
+		o.VibratoRate = ctx.Float64("vibrato-rate")
+		o.VibratoDelayMsec = ctx.Float64("vibrato-delay")
+		if o.VibratoDepth < 0 || 200.0 < o.VibratoDepth || o.VibratoRate < .5 || 20.0 < o.VibratoRate || o.VibratoDelayMsec < 0 || 5000.0 < o.VibratoDelayMsec {
+			err := xerrors.New("ビブラートの深さは 0..200、速さは 0.5..20、開始までの時間は 0..5000 の数値である必要があります")
+			return cli.NewExitError(err, 1)
+		}
+		o.VibratoReduction = ctx.Float64("vibrato-reduce")
+		if o.VibratoReduction < 0 || 1.0 < o.VibratoReduction {
+			err := xerrors.New("ビブラートを抑える割合は 0..1 の数値である必要があります")
+			return cli.NewExitError(err, 1)
+		}
+		o.Jitter = ctx.Float64("jitter")
+		o.Shimmer = ctx.Float64("shimmer")
+		if o.Jitter < 0 || 10.0 < o.Jitter || o.Shimmer < 0 || 6.0 < o.Shimmer {
+			err := xerrors.New("ジッタは 0..10、シマーは 0..6 の数値である必要があります")
+			return cli.NewExitError(err, 1)
+		}
+
+		o.MonotoneFreq = ctx.Float64("monotone")
+		if o.MonotoneFreq != 0 && (o.MonotoneFreq < 50.0 || 1000.0 < o.MonotoneFreq) {
+			err := xerrors.New("一定とする基本周波数は 50..1000 の数値である必要があります")
+			return cli.NewExitError(err, 1)
+		}
+		if 0 < o.MonotoneFreq && (o.PitchEngine == "vocoder" || o.Carrier != "" || o.Whisper) {
+			err := xerrors.New("一定の基本周波数は位相ボコーダ・チャンネルボコーダ・ささやき声と同時に使用できません")
+			return cli.NewExitError(err, 1)
+		}
+
+		o.EchoReference = ctx.String("aec-reference")
+
+		o.TargetVoice = ctx.String("target-voice")
+		if o.TargetVoice != "" && o.PitchEngine == "vocoder" {
+			err := xerrors.New("目標の話者は位相ボコーダと同時に使用できません")
+			return cli.NewExitError(err, 1)
+		}
+
 		if 1 <= ctx.NArg() {
 			o.InFile = ctx.Args()[0]
 		}
@@ -170,6 +667,85 @@ var convertCmd = cli.Command{
 	},
 }
 
+var morphCmd = cli.Command{
+	Name:      "morph",
+	Aliases:   []string{"m"},
+	Usage:     "同じ内容の2つの発話の間を補間した音声を作成します",
+	ArgsUsage: "<input-file> <morph-file> [ <output-file> ]",
+	Flags: append(
+		commonFlags,
+		cli.Float64Flag{
+			Name:  "frame-period, p",
+			Usage: "フレームピリオド [msec]",
+			Value: 5.0,
+		},
+		cli.StringFlag{
+			Name:  "pitch-marks",
+			Usage: "ピッチシフト時の周期の区切り方（epoch: 声門閉鎖時刻に合わせる, phase: 基本周波数の位相のみ）",
+			Value: "epoch",
+		},
+		cli.StringFlag{
+			Name:  "ratio",
+			Usage: "モーフィングの比率 0..1（0: input-file, 1: morph-file）。\"時刻[sec]:比率\" のカンマ区切りで時間変化させることも可能",
+			Value: "0.5",
+		},
+		cli.Float64Flag{
+			Name:  "intonation",
+			Usage: "平均の基本周波数を中心とした抑揚の幅の倍率（0.5: 平坦に, 1.5: 大げさに）",
+			Value: 1.0,
+		},
+	),
+	Action: func(ctx *cli.Context) error {
+		o, err := parseFlags(ctx)
+		if err != nil {
+			return err
+		}
+
+		if ctx.NArg() < 2 {
+			cli.ShowCommandHelpAndExit(ctx, "morph", 1)
+		}
+
+		o.PitchMarks = ctx.String("pitch-marks")
+		if o.PitchMarks != "epoch" && o.PitchMarks != "phase" {
+			err := xerrors.New("周期の区切り方は epoch, phase のいずれかである必要があります")
+			return cli.NewExitError(err, 1)
+		}
+
+		if o.PitchEngine == "vocoder" {
+			err := xerrors.New("モーフィングは位相ボコーダと同時に使用できません")
+			return cli.NewExitError(err, 1)
+		}
+		if o.Mix != 1 {
+			err := xerrors.New("モーフィングではタイミングが変化するため、ミックス比率は指定できません")
+			return cli.NewExitError(err, 1)
+		}
+
+		intonation := ctx.Float64("intonation")
+		if intonation < 0 || 3.0 < intonation {
+			err := xerrors.New("抑揚の幅の倍率は 0..3 の数値である必要があります")
+			return cli.NewExitError(err, 1)
+		}
+		o.IntonationOffset = intonation - 1
+
+		o.MorphRatio = ctx.String("ratio")
+		if _, err := control.ParseCurve(o.MorphRatio); err != nil {
+			err := xerrors.Errorf("モーフィングの比率は数値、または \"時刻[sec]:比率\" のカンマ区切りである必要があります: %w", err)
+			return cli.NewExitError(err, 1)
+		}
+
+		o.InFile = ctx.Args()[0]
+		o.MorphFile = ctx.Args()[1]
+		if 3 <= ctx.NArg() {
+			o.OutFile = ctx.Args()[2]
+		}
+
+		if err := voispire.Start(o); err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		return nil
+	},
+}
+
 func main() {
 	defer func() {
 		if onExit != nil {
@@ -196,6 +772,7 @@ func main() {
 		deviceCmd,
 		startCmd,
 		convertCmd,
+		morphCmd,
 	}
 
 	app.Action = func(ctx *cli.Context) error {
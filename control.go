@@ -0,0 +1,216 @@
+package voispire
+
+import (
+	"log"
+	"math"
+	"os"
+
+	"github.com/but80/voispire/internal/control"
+	"github.com/xlab/closer"
+)
+
+// controller は、変換中に変更可能なパラメータを保持し、外部からの操作を受け付けます。
+type controller struct {
+	formant      *control.Value // フォルマントシフト量 [半音]
+	tilt         *control.Value // スペクトルの傾き [dB/oct]
+	transpose    *control.Value // ピッチシフト量 [半音]
+	note         *control.Value // 目標の基本周波数 [Hz]（0 のとき無効）
+	mix          *control.Value // ウェットの比率 (0..1)
+	monotone     float64        // 単調なピッチとする基本周波数 [Hz]（0 のとき無効）
+	intonation   float64        // 平均の基本周波数を中心とした抑揚の幅の倍率（1 のとき無効）
+	logF0Mean    float64        // 入力の基本周波数の自然対数の平均
+	modulation   *pitchModulation
+	pitchEnabled bool
+	// noteEnabled は、目標の基本周波数（MIDIのノート）によるピッチ操作が有効かどうかです。
+	// 入力の基本周波数が既知の場合か、発振器の周波数を直接変える場合のみ有効となります。
+	noteEnabled bool
+	// tracks は、MIDIファイルから再生されるパラメータの時系列です。
+	// パラメータ名が含まれる場合、対応する値よりも優先されます。
+	tracks map[string]*control.Timeline
+	// f0 は、入力の時刻 t [sec] における基本周波数 [Hz] を返します（不明なときは 0）。
+	f0 func(t float64) float64
+	// f0Map は、入力の時刻 t [sec] における基本周波数 f0 [Hz] を、
+	// 目標の話者やモーフィング先の基本周波数 [Hz] に対応付けます（nil のときは無効）。
+	f0Map func(t, f0 float64) float64
+}
+
+func newController(o Options, pitchEnabled bool) *controller {
+	return &controller{
+		formant:      control.NewValue(o.Formant),
+		tilt:         control.NewValue(o.Tilt),
+		transpose:    control.NewValue(o.Transpose),
+		note:         control.NewValue(0),
+		mix:          control.NewValue(o.Mix),
+		monotone:     o.MonotoneFreq,
+		intonation:   1 + o.IntonationOffset,
+		pitchEnabled: pitchEnabled,
+		tracks:       map[string]*control.Timeline{},
+		f0: func(t float64) float64 {
+			return 0
+		},
+	}
+}
+
+// value は、名前 name に対応する値を返します。
+func (c *controller) value(name string) *control.Value {
+	switch name {
+	case "formant":
+		return c.formant
+	case "tilt":
+		return c.tilt
+	case "transpose":
+		return c.transpose
+	case "note":
+		return c.note
+	case "mix":
+		return c.mix
+	}
+	return nil
+}
+
+// param は、名前 name のパラメータを返します。
+func (c *controller) param(name string) control.Param {
+	if tl, ok := c.tracks[name]; ok {
+		return tl
+	}
+	return c.value(name)
+}
+
+// pitchRatio は、時刻 t [sec] におけるピッチシフトの比率を返します。
+// 目標の基本周波数が指定されている場合は、入力の基本周波数をその周波数に合わせる比率となります。
+// それ以外の場合は、ピッチシフト量による比率に contourRatio をかけたものとなります。
+func (c *controller) pitchRatio(t float64) float64 {
+	if !c.pitchEnabled {
+		return 1
+	}
+	if note := c.param("note").At(t); 0 < note {
+		if f0 := c.f0(t); 0 < f0 {
+			return note / f0
+		}
+	}
+	return math.Pow(2.0, c.param("transpose").At(t)/12.0) * c.contourRatio(t)
+}
+
+// contourRatio は、時刻 t [sec] において、基本周波数の軌跡を変更するための比率を返します。
+// 単調なピッチ・抑揚の幅・目標の話者やモーフィング先への対応付け・ビブラート等が指定されている場合に、
+// 入力の基本周波数を変更後の基本周波数に合わせる比率となります（それ以外は 1）。
+// 入力の基本周波数に追従して周期ごとに変化するため、ストレッチャはこの成分を平滑化しません。
+func (c *controller) contourRatio(t float64) float64 {
+	if !c.pitchEnabled || 0 < c.param("note").At(t) {
+		return 1
+	}
+	f0 := c.f0(t)
+	if f0 <= 0 {
+		return 1
+	}
+	var target float64
+	if 0 < c.monotone {
+		target = c.monotone
+	} else {
+		target = f0
+		if c.modulation != nil {
+			target = c.modulation.flatten(t, target)
+		}
+		if c.intonation != 1 {
+			target = math.Exp(c.logF0Mean + (math.Log(target)-c.logF0Mean)*c.intonation)
+		}
+		if c.f0Map != nil {
+			target = c.f0Map(t, target)
+		}
+	}
+	if c.modulation != nil {
+		target = c.modulation.modulate(t, target)
+	}
+	return target / f0
+}
+
+// formantRatio は、時刻 t [sec] におけるフォルマントシフトの比率を返します。
+func (c *controller) formantRatio(t float64) float64 {
+	return math.Pow(2.0, c.param("formant").At(t)/12.0)
+}
+
+// tiltCoef は、フォルマントシフタに与えるスペクトルの傾き [dB/oct] を返します。
+func (c *controller) tiltCoef() control.Param {
+	return control.Func(func(t float64) float64 {
+		return c.param("tilt").At(t)
+	})
+}
+
+// pitchCoef は、ストレッチャに与える係数を返します。
+func (c *controller) pitchCoef() control.Param {
+	return control.Func(c.pitchRatio)
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
+
+// set は、名前 name のパラメータに値 v を設定します。
+func (c *controller) set(name string, v float64) {
+	switch name {
+	case "formant", "f":
+		v = clamp(v, -12, 12)
+		c.formant.Set(v)
+		log.Printf("info: フォルマントシフト量: %.2f", v)
+	case "tilt":
+		v = clamp(v, -12, 12)
+		c.tilt.Set(v)
+		log.Printf("info: スペクトルの傾き: %.2f dB/oct", v)
+	case "transpose", "t":
+		if !c.pitchEnabled {
+			log.Print("warn: ピッチシフトが有効でないため、ピッチシフト量は変更できません")
+			return
+		}
+		v = clamp(v, -12, 12)
+		c.transpose.Set(v)
+		log.Printf("info: ピッチシフト量: %.2f", v)
+	case "note":
+		if !c.noteEnabled {
+			return
+		}
+		c.note.Set(math.Max(0, v))
+		log.Printf("debug: 目標の基本周波数: %.2f Hz", v)
+	case "mix", "m":
+		v = clamp(v, 0, 1)
+		c.mix.Set(v)
+		log.Printf("info: ミックス比率: %.2f", v)
+	default:
+		log.Printf("warn: 不明なパラメータです: %s", name)
+	}
+}
+
+// isLive は、変換中にパラメータが変更される可能性があるかどうかを返します。
+func isLive(o Options) bool {
+	return o.ControlStdin || o.ControlAddr != "" || o.OSCAddr != "" || o.MIDIPort != ""
+}
+
+// listen は、オプションで指定された操作の受け付けを開始します。
+func (c *controller) listen(o Options) error {
+	if o.ControlStdin {
+		log.Print(`info: 標準入力から "formant 3" のような形式でパラメータを変更できます`)
+		go control.ServeLines(os.Stdin, c.set)
+	}
+	if o.ControlAddr != "" {
+		ln, err := control.ListenTCP(o.ControlAddr, c.set)
+		if err != nil {
+			return err
+		}
+		log.Printf("info: コントロールソケットを待ち受けています: %s", o.ControlAddr)
+		closer.Bind(func() {
+			log.Print("debug: closing control socket")
+			ln.Close()
+		})
+	}
+	if o.OSCAddr != "" {
+		conn, err := control.ListenOSC(o.OSCAddr, c.set)
+		if err != nil {
+			return err
+		}
+		log.Printf("info: OSCポートを待ち受けています: %s", o.OSCAddr)
+		closer.Bind(func() {
+			log.Print("debug: closing OSC port")
+			conn.Close()
+		})
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package voispire
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestController_contourRatio(t *testing.T) {
+	tests := []struct {
+		name  string
+		o     Options
+		f0Map func(t, f0 float64) float64
+		f0    float64
+		want  float64
+	}{
+		{name: "disabled by default", f0: 200, want: 1},
+		{name: "unvoiced", o: Options{MonotoneFreq: 100}, f0: 0, want: 1},
+		{name: "monotone", o: Options{MonotoneFreq: 100}, f0: 200, want: .5},
+		// 平均 200Hz を中心に、抑揚の幅を2倍にする
+		{name: "intonation above the mean", o: Options{IntonationOffset: 1}, f0: 400, want: 2},
+		{name: "intonation below the mean", o: Options{IntonationOffset: 1}, f0: 100, want: .5},
+		{name: "flat intonation", o: Options{IntonationOffset: -1}, f0: 300, want: 200.0 / 300},
+		{
+			name:  "intonation before mapping",
+			o:     Options{IntonationOffset: 1},
+			f0Map: func(t, f0 float64) float64 { return f0 * 1.5 },
+			f0:    400,
+			want:  3,
+		},
+		{
+			name:  "monotone ignores mapping",
+			o:     Options{MonotoneFreq: 100},
+			f0Map: func(t, f0 float64) float64 { return f0 * 1.5 },
+			f0:    200,
+			want:  .5,
+		},
+	}
+	for _, tt := range tests {
+		c := newController(tt.o, true)
+		c.logF0Mean = math.Log(200)
+		c.f0Map = tt.f0Map
+		f0 := tt.f0
+		c.f0 = func(t float64) float64 { return f0 }
+		assert.InDelta(t, tt.want, c.contourRatio(1), 1e-9, tt.name)
+	}
+
+	// ピッチシフトが無効な場合や、目標の基本周波数が指定されている場合は変更しない
+	c := newController(Options{MonotoneFreq: 100}, false)
+	c.f0 = func(t float64) float64 { return 200 }
+	assert.Equal(t, 1.0, c.contourRatio(1))
+	c = newController(Options{MonotoneFreq: 100}, true)
+	c.f0 = func(t float64) float64 { return 200 }
+	c.note.Set(440)
+	assert.Equal(t, 1.0, c.contourRatio(1))
+	assert.InDelta(t, 440.0/200, c.pitchRatio(1), 1e-9)
+}
+
+func TestController_contourRatio_modulation(t *testing.T) {
+	track := vibratoTrack()
+	c := newController(Options{}, true)
+	c.f0 = track.Freq
+	c.modulation = &pitchModulation{track: track, rate: 5, depth: 100}
+	// 単調なピッチにもビブラートを加える
+	c.monotone = 100
+	u := .05 // 有声区間の開始から 5Hz の 1/4 周期
+	assert.InDelta(t, 100*u/vibratoFadeTime, cents(c.contourRatio(.5+u)*track.Freq(.5+u), 100), 1e-6)
+}
+
+func TestController_contourRatio_monotoneTrack(t *testing.T) {
+	track := vibratoTrack()
+	c := newController(Options{MonotoneFreq: 150}, true)
+	c.f0 = track.Freq
+	// 入力の基本周波数の変化によらず、出力の基本周波数は一定となる
+	for at := .5; at <= 2; at += .01 {
+		assert.InDelta(t, 150, c.contourRatio(at)*track.Freq(at), 1e-9, "t=%g", at)
+	}
+	// 無声区間では変更しない
+	assert.Equal(t, 1.0, c.contourRatio(.25))
+}
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/but80/voispire/internal/aec"
 	"github.com/but80/voispire/internal/buffer"
 	"github.com/gordonklaus/portaudio"
 	"github.com/mattn/go-runewidth"
@@ -250,8 +252,16 @@ func initAudio(o Options) (portaudio.StreamParameters, error) {
 	return portaudio.LowLatencyParameters(inDev, outDev), nil
 }
 
-func render(params portaudio.StreamParameters, input *buffer.WaveSource, outCh <-chan float64, fileOutCh chan<- []float64) (<-chan struct{}, *portaudio.Stream, error) {
+// echoDelayMargin は、エコーキャンセラの参照信号の遅延をデバイスのレイテンシより短くする余裕 [sec] です。
+// 報告されるレイテンシの誤差を、適応フィルタの長さの範囲で吸収します。
+const echoDelayMargin = .02
+
+// render は、オーディオデバイスの入出力を開始します。
+// outChannels が 2 の場合、 outCh には左右のサンプルが交互に並んでいるものとして扱います。
+// echoTail が正の場合、出力した音声を参照信号として、入力からその長さ [sec] までのエコーを除去します。
+func render(params portaudio.StreamParameters, input *buffer.WaveSource, outCh <-chan float64, outChannels int, fileOutCh chan<- []float64, echoTail float64) (<-chan struct{}, *portaudio.Stream, error) {
 	waitCh := make(chan struct{})
+	var canceller *aec.Canceller
 	onIn := func(in [][]float32) {
 		if len(in) == 0 {
 			return
@@ -261,31 +271,50 @@ func render(params portaudio.StreamParameters, input *buffer.WaveSource, outCh <
 		for i := 0; i < n; i++ {
 			buf[i] = float64(in[0][i])
 		}
+		if canceller != nil {
+			canceller.Capture(buf, buf)
+		}
 		input.Append(buf)
 	}
 
 	bufferUnderrunAt := time.Unix(0, 0)
 	f64buf := make([]float64, 0)
-	onOut := func(out [][]float32) {
-		i := 0
-		n := len(out[0])
-		f64buf = f64buf[:0]
-		for ; i < n; i++ {
+	// refbuf は、エコー除去の参照信号としてコールバックごとに渡す出力のモノラル版です。
+	refbuf := make([]float64, 0)
+	// frame は、読み込み途中のフレーム（ステレオでは左右のサンプル）です。
+	// 揃わなかった分は次のコールバックに持ち越し、リアルタイムのスレッドを待たせないようにします。
+	frame := make([]float64, 0, outChannels)
+	readFrame := func() (ready, closed bool) {
+		for len(frame) < outChannels {
 			select {
 			case v, ok := <-outCh:
 				if !ok {
-					if waitCh != nil {
-						close(waitCh)
-						waitCh = nil
-					}
-					break
+					return false, true
 				}
-				out[0][i] = float32(v)
-				out[1][i] = float32(v)
-				f64buf = append(f64buf, v)
+				frame = append(frame, v)
 			default:
+				return false, false
+			}
+		}
+		return true, false
+	}
+	onOut := func(out [][]float32) {
+		i := 0
+		n := len(out[0])
+		f64buf = f64buf[:0]
+		for ; i < n; i++ {
+			ready, closed := readFrame()
+			if closed && waitCh != nil {
+				close(waitCh)
+				waitCh = nil
+			}
+			if !ready {
 				break
 			}
+			out[0][i] = float32(frame[0])
+			out[1][i] = float32(frame[len(frame)-1])
+			f64buf = append(f64buf, frame...)
+			frame = frame[:0]
 		}
 		if i < n && waitCh != nil && time.Second <= time.Since(bufferUnderrunAt) {
 			log.Printf("warn: buffer underrun")
@@ -295,6 +324,13 @@ func render(params portaudio.StreamParameters, input *buffer.WaveSource, outCh <
 			out[0][i] = 0
 			out[1][i] = 0
 		}
+		if canceller != nil {
+			refbuf = refbuf[:0]
+			for i := 0; i < n; i++ {
+				refbuf = append(refbuf, (float64(out[0][i])+float64(out[1][i]))/2)
+			}
+			canceller.Render(refbuf)
+		}
 		if fileOutCh != nil {
 			// FIXME: closeされている可能性、このコールバックからは処理を分離
 			fileOutCh <- f64buf
@@ -304,9 +340,10 @@ func render(params portaudio.StreamParameters, input *buffer.WaveSource, outCh <
 	var onProcess interface{} = onOut
 	if input != nil {
 		if outCh != nil {
+			// エコーキャンセラの参照信号が入力より先に揃うよう、出力を先に処理する
 			onProcess = func(in, out [][]float32) {
-				onIn(in)
 				onOut(out)
+				onIn(in)
 			}
 		} else {
 			onProcess = onIn
@@ -321,6 +358,13 @@ func render(params portaudio.StreamParameters, input *buffer.WaveSource, outCh <
 	log.Printf("info: Input latency: %s\n", stream.Info().InputLatency.String())
 	log.Printf("info: Output latency: %s\n", stream.Info().OutputLatency.String())
 
+	if 0 < echoTail && input != nil && outCh != nil {
+		info := stream.Info()
+		delay := (info.InputLatency + info.OutputLatency).Seconds() - echoDelayMargin
+		canceller = aec.New(int(echoTail*info.SampleRate), int(delay*info.SampleRate), aec.DefaultStep)
+		log.Printf("info: エコーキャンセラを使用します（参照信号の遅延 %.0f msec）", math.Max(0, delay)*1000)
+	}
+
 	if err := stream.Start(); err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,28 @@
+package voispire
+
+import (
+	"log"
+
+	"github.com/but80/voispire/internal/aec"
+	"github.com/but80/voispire/internal/wav"
+	"golang.org/x/xerrors"
+)
+
+// cancelEchoFile は、入力ファイル o.InFile を読み込み、録音中に再生していた音声ファイル o.EchoReference のエコーを除去した波形を返します。
+// 2つのファイルは同時に録音・再生を開始したものとし、その間の遅延は適応フィルタの長さ o.EchoTailMsec の範囲で吸収します。
+func cancelEchoFile(o Options) ([]float64, int, error) {
+	mic, fs, err := wav.Load(o.InFile)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("音声ファイルの読み込みに失敗しました: %w", err)
+	}
+	ref, fsRef, err := wav.Load(o.EchoReference)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("参照信号の音声ファイルの読み込みに失敗しました: %w", err)
+	}
+	if fsRef != fs {
+		return nil, 0, xerrors.Errorf("参照信号のサンプリング周波数が入力と異なります (%d != %d)", fsRef, fs)
+	}
+	log.Print("info: エコーを除去中...")
+	taps := int(o.EchoTailMsec / 1000 * float64(fs))
+	return aec.Cancel(mic, ref, taps, aec.DefaultStep), fs, nil
+}
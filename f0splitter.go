@@ -5,30 +5,69 @@ import (
 	"math"
 
 	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/f0track"
 )
 
 const (
 	minFreq = 1.0
+
+	// epochSearch は、予測した次の周期の開始位置の前後どれだけの範囲でエポックを探索するか [周期] です。
+	epochSearch = .3
+	// epochMinCrest は、エポックとみなす残差のピーク値の、探索範囲の実効値に対する最小比です。
+	epochMinCrest = 1.5
+	// splitterTrimLen は、出力済みの波形を破棄する間隔 [サンプル] です。
+	// 長時間のストリーミングでバッファが増え続けないようにします。
+	splitterTrimLen = 1 << 16
 )
 
+// epochSmoother は、残差の平滑化に用いるゼロ位相フィルタの係数です。
+var epochSmoother = []float64{1. / 9, 2. / 9, 3. / 9, 2. / 9, 1. / 9}
+
 type f0Splitter struct {
-	input       <-chan float64
-	output      chan buffer.Shape
-	f0          []float64
-	fs          float64
-	framePeriod float64
+	input  <-chan float64
+	output chan buffer.Shape
+	f0     *f0track.Track
+	fs     float64
+	// live が nil でない場合、 f0 の代わりに入力から逐次推定した基本周波数を使用します。
+	live *liveF0
+	// voiced は、時刻 t [sec] が音声区間かどうかを返します。
+	// nil でない場合、音声区間でない時刻は f0 によらず無声として扱います。
+	voiced func(t float64) bool
+	// useEpoch が true の場合、各周期の開始位置を声門閉鎖時刻（エポック）に合わせます。
+	// false の場合、基本周波数から累積した位相のみで区切ります。
+	useEpoch bool
 }
 
-func newF0Splitter(f0 []float64, fs, framePeriod float64) *f0Splitter {
+func newF0Splitter(f0 *f0track.Track, fs float64, useEpoch bool) *f0Splitter {
 	return &f0Splitter{
-		f0:          f0,
-		fs:          fs,
-		framePeriod: framePeriod,
-		output:      make(chan buffer.Shape, 4096),
+		f0:       f0,
+		fs:       fs,
+		useEpoch: useEpoch,
+		output:   make(chan buffer.Shape, 4096),
+	}
+}
+
+// freqAt は、時刻 t [sec] における基本周波数 [Hz] と、有声かどうかを返します。
+// 無声の場合は、直前の基本周波数 lastFreq を返します。
+func (s *f0Splitter) freqAt(t, lastFreq float64) (float64, bool) {
+	var f0 float64
+	var ok bool
+	if s.live != nil {
+		f0, ok = s.live.At(t)
+	} else {
+		f0, ok = s.f0.At(t)
 	}
+	if ok && minFreq <= f0 && (s.voiced == nil || s.voiced(t)) {
+		return f0, true
+	}
+	return lastFreq, false
 }
 
 func (s *f0Splitter) Start() {
+	if s.useEpoch {
+		s.startEpoch()
+		return
+	}
 	go func() {
 		log.Print("debug: f0Splitter goroutine is started")
 		t := .0
@@ -41,11 +80,10 @@ func (s *f0Splitter) Start() {
 		for v := range s.input {
 			i := len(buf)
 			buf = append(buf, v)
-			j := int(math.Floor(t / float64(s.framePeriod)))
-			freq := lastFreq
-			if j < len(s.f0) && minFreq <= s.f0[j] {
-				freq = s.f0[j]
+			if s.live != nil {
+				s.live.push(v)
 			}
+			freq, _ := s.freqAt(t, lastFreq)
 			phase += freq * dt
 			if 1.0 <= phase {
 				for 1.0 <= phase {
@@ -54,11 +92,113 @@ func (s *f0Splitter) Start() {
 				s.output <- buffer.MakeShapeTrimmed(buf, iBegin, i)
 				msg++
 				iBegin = i
+				if splitterTrimLen <= iBegin {
+					// 出力済みの Shape は元の配列を参照し続けるため、未出力の部分のみを新しい配列に移す
+					buf = append([]float64{}, buf[iBegin:]...)
+					iBegin = 0
+				}
 			}
 			lastFreq = freq
 			t += dt
 		}
+		if iBegin < len(buf) {
+			// 最後の区切り以降の波形も出力し、入力と出力のサンプル数を揃える
+			s.output <- buffer.MakeShapeTrimmed(buf, iBegin, len(buf))
+			msg++
+		}
 		log.Printf("debug: f0Splitter %d messages", msg)
 		close(s.output)
 	}()
 }
+
+// residual は、位置 i における声門閉鎖を強調した残差（平滑化した負の微分）を返します。
+func residual(buf []float64, i int) float64 {
+	w := len(epochSmoother) / 2
+	v := .0
+	for k, c := range epochSmoother {
+		j := i + k - w
+		if j < 1 || len(buf) <= j {
+			continue
+		}
+		v += c * (buf[j-1] - buf[j])
+	}
+	return v
+}
+
+// findEpoch は、 buf の範囲 [lo, hi] で残差が最大となる位置を返します。
+// ピークが十分に際立っていない場合、第2の返り値が false となります。
+func findEpoch(buf []float64, lo, hi int) (int, bool) {
+	best := lo
+	bestValue := math.Inf(-1)
+	sum := .0
+	for i := lo; i <= hi; i++ {
+		v := residual(buf, i)
+		sum += v * v
+		if bestValue < v {
+			best = i
+			bestValue = v
+		}
+	}
+	rms := math.Sqrt(sum / float64(hi-lo+1))
+	if bestValue <= 0 || bestValue < rms*epochMinCrest {
+		return 0, false
+	}
+	return best, true
+}
+
+// startEpoch は、予測した次の周期の開始位置の付近からエポックを探索して区切ります。
+// 無声区間やエポックが見つからない場合は、予測した位置で区切ります。
+func (s *f0Splitter) startEpoch() {
+	go func() {
+		log.Print("debug: f0Splitter goroutine is started (epoch)")
+		iBegin := 0
+		offset := 0 // buf の先頭の位置 [サンプル]
+		lastFreq := 440.0
+		buf := []float64{}
+		msg := 0
+		found := 0
+		for v := range s.input {
+			buf = append(buf, v)
+			if s.live != nil {
+				s.live.push(v)
+			}
+			for {
+				freq, voiced := s.freqAt(float64(offset+iBegin)/s.fs, lastFreq)
+				period := s.fs / freq
+				lo := iBegin + int(period*(1-epochSearch))
+				hi := iBegin + int(period*(1+epochSearch))
+				if len(buf) <= hi+len(epochSmoother)/2 {
+					// 探索範囲の先読みが揃うまで待つ
+					break
+				}
+				iEnd := iBegin + int(period+.5)
+				if voiced && lo < hi {
+					if i, ok := findEpoch(buf, lo, hi); ok {
+						iEnd = i
+						found++
+					}
+				}
+				if iEnd <= iBegin {
+					iEnd = iBegin + 1
+				}
+				s.output <- buffer.MakeShapeTrimmed(buf, iBegin, iEnd)
+				msg++
+				iBegin = iEnd
+				lastFreq = freq
+				if splitterTrimLen <= iBegin {
+					// 出力済みの Shape は元の配列を参照し続けるため、未出力の部分のみを新しい配列に移す
+					buf = append([]float64{}, buf[iBegin:]...)
+					offset += iBegin
+					iBegin = 0
+				}
+			}
+		}
+		if iBegin < len(buf) {
+			// 最後の区切り以降の波形も出力し、入力と出力のサンプル数を揃える
+			s.output <- buffer.MakeShapeTrimmed(buf, iBegin, len(buf))
+			msg++
+		}
+		log.Printf("debug: f0Splitter %d messages (%d epochs)", msg, found)
+		close(s.output)
+	}()
+}
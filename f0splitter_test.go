@@ -0,0 +1,105 @@
+package voispire
+
+import (
+	"testing"
+
+	"github.com/but80/voispire/internal/f0track"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	splitterTestFs     = 10000
+	splitterTestPeriod = 100 // 100Hz
+	splitterTestPulse  = 13  // 最初の声門閉鎖の位置 [サンプル]
+)
+
+// glottalWave は、各周期の位置 splitterTestPulse で急激に立ち下がる声門波状の波形を返します。
+func glottalWave(n int) []float64 {
+	result := make([]float64, n)
+	for i := range result {
+		p := (i - splitterTestPulse + splitterTestPeriod) % splitterTestPeriod
+		result[i] = float64(p)/splitterTestPeriod - .5
+	}
+	return result
+}
+
+// constTrack は、 dur [sec] の間 f0 [Hz] で一定の基本周波数の系列を返します。
+func constTrack(f0, dur float64) *f0track.Track {
+	return f0track.New([]float64{0, dur}, []float64{f0, f0})
+}
+
+// runSplitter は、 input を区切った各 Shape の開始位置と長さを返します。
+func runSplitter(s *f0Splitter, input []float64) (begins, lengths []int) {
+	ch := make(chan float64, len(input))
+	for _, v := range input {
+		ch <- v
+	}
+	close(ch)
+	s.input = ch
+	s.Start()
+	pos := 0
+	for shape := range s.output {
+		n := len(shape.Data())
+		begins = append(begins, pos)
+		lengths = append(lengths, n)
+		pos += n
+	}
+	return begins, lengths
+}
+
+func sum(values []int) int {
+	result := 0
+	for _, v := range values {
+		result += v
+	}
+	return result
+}
+
+func TestF0Splitter_epoch(t *testing.T) {
+	const n = splitterTestFs
+	input := glottalWave(n)
+	// 基本周波数の推定がずれていても、区切りは声門閉鎖の位置に揃う
+	s := newF0Splitter(constTrack(95, 1), splitterTestFs, true)
+	begins, lengths := runSplitter(s, input)
+	assert.Equal(t, n, sum(lengths))
+	assert.Equal(t, 0, begins[0])
+	for i, b := range begins[1 : len(begins)-1] {
+		assert.Equal(t, splitterTestPulse, b%splitterTestPeriod, "shape %d", i+1)
+		assert.Equal(t, splitterTestPeriod, lengths[i+1], "shape %d", i+1)
+		// 各 Shape は同じ位相から始まる
+		assert.Equal(t, input[splitterTestPulse], input[b], "shape %d", i+1)
+	}
+}
+
+func TestF0Splitter_epochFallback(t *testing.T) {
+	const n = splitterTestFs
+	t.Run("無声区間では直前の基本周期で区切る", func(t *testing.T) {
+		s := newF0Splitter(constTrack(0, 1), splitterTestFs, true)
+		_, lengths := runSplitter(s, glottalWave(n))
+		assert.Equal(t, n, sum(lengths))
+		period := splitterTestFs / 440.0
+		for _, l := range lengths[:len(lengths)-1] {
+			assert.Equal(t, int(period+.5), l)
+		}
+	})
+	t.Run("エポックが見つからない場合は予測した位置で区切る", func(t *testing.T) {
+		s := newF0Splitter(constTrack(80, 1), splitterTestFs, true)
+		_, lengths := runSplitter(s, make([]float64, n))
+		assert.Equal(t, n, sum(lengths))
+		for _, l := range lengths[:len(lengths)-1] {
+			assert.Equal(t, splitterTestFs/80, l)
+		}
+	})
+}
+
+func TestF0Splitter_phase(t *testing.T) {
+	// 区切り位置に関わらず、入力の末尾まで出力する
+	for _, n := range []int{splitterTestFs, splitterTestFs + 37} {
+		s := newF0Splitter(constTrack(100, 2), splitterTestFs, false)
+		_, lengths := runSplitter(s, glottalWave(n))
+		assert.Equal(t, n, sum(lengths))
+		for _, l := range lengths[1 : len(lengths)-1] {
+			assert.InDelta(t, splitterTestPeriod, l, 1)
+		}
+	}
+}
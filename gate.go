@@ -0,0 +1,74 @@
+package voispire
+
+import (
+	"log"
+	"sync"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/gate"
+)
+
+// gateBlockLen は、ノイズゲートが判定を行うブロックの長さ [サンプル] です。
+const gateBlockLen = 256
+
+// noiseGate は、入力にノイズゲートを適用し、ブロックごとの音声区間の判定結果を記録します。
+type noiseGate struct {
+	input  *buffer.WaveSource
+	output *buffer.WaveSource
+	gate   *gate.Gate
+	fs     float64
+	// f0 は、入力の時刻 t [sec] における基本周波数 [Hz] を返します（不明なときは 0）。
+	// nil でない場合、有声判定に自己相関の代わりに使用されます。
+	f0     func(t float64) float64
+	states []bool
+	mutex  sync.Mutex
+}
+
+func newNoiseGate(input *buffer.WaveSource, fs int, o Options) *noiseGate {
+	return &noiseGate{
+		input:  input,
+		output: buffer.NewWaveSource(),
+		gate:   gate.New(fs, o.GateThreshold, o.GateAttackMsec/1000, o.GateReleaseMsec/1000, o.GateVoicing),
+		fs:     float64(fs),
+	}
+}
+
+// active は、時刻 t [sec] が音声区間と判定されたかどうかを返します。
+// まだ判定されていない時刻は音声区間とみなします。
+func (g *noiseGate) active(t float64) bool {
+	i := int(t * g.fs / gateBlockLen)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if i < 0 || len(g.states) <= i {
+		return true
+	}
+	return g.states[i]
+}
+
+func (g *noiseGate) Start() {
+	go func() {
+		log.Print("debug: noiseGate goroutine is started")
+		defer g.output.Close()
+		i := 0
+		for {
+			src, cont := g.input.Read(i, i+gateBlockLen)
+			var voiced *bool
+			if g.f0 != nil {
+				v := 0 < g.f0((float64(i)+gateBlockLen/2)/g.fs)
+				voiced = &v
+			}
+			dst := make([]float64, len(src))
+			g.gate.Process(dst, src, voiced)
+			g.mutex.Lock()
+			g.states = append(g.states, g.gate.Active())
+			g.mutex.Unlock()
+			g.output.Append(dst)
+			g.input.DiscardUntil(i + len(src))
+			if !cont {
+				break
+			}
+			i += gateBlockLen
+		}
+		log.Printf("debug: noiseGate %d blocks", len(g.states))
+	}()
+}
@@ -0,0 +1,167 @@
+package voispire
+
+import (
+	"log"
+	"math"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/fft"
+	"github.com/but80/voispire/internal/formant"
+)
+
+// Voice は、ハーモニーとして追加する声部の設定です。
+type Voice struct {
+	// Interval は、主声部からの音程 [半音] です。
+	Interval float64
+	// Formant は、主声部からのフォルマントシフト量 [半音] です。
+	Formant float64
+	// Gain は、音量 [dB] です。
+	Gain float64
+	// Pan は、定位です。 -1 で左端、 0 で中央、 1 で右端となります。
+	Pan float64
+}
+
+// harmony は、共通の f0Splitter の出力から複数の声部を生成し、ステレオにミックスします。
+// 出力は左右のサンプルが交互に並んだものとなります。
+type harmony struct {
+	output     chan float64
+	stretchers []*stretcher
+	shifters   []formant.FormantShifter
+	inputs     []<-chan float64
+	gainL      []float64
+	gainR      []float64
+}
+
+// teeShapes は、 input から読み込んだ Shape を n 個のチャンネルに複製します。
+func teeShapes(input <-chan buffer.Shape, n int) []<-chan buffer.Shape {
+	outs := make([]chan buffer.Shape, n)
+	result := make([]<-chan buffer.Shape, n)
+	for i := range outs {
+		outs[i] = make(chan buffer.Shape, 16)
+		result[i] = outs[i]
+	}
+	go func() {
+		for s := range input {
+			for _, out := range outs {
+				out <- s
+			}
+		}
+		for _, out := range outs {
+			close(out)
+		}
+	}()
+	return result
+}
+
+// feedWaveSource は、 input から読み込んだ波形を WaveSource に供給するゴルーチンを開始します。
+func feedWaveSource(input <-chan float64) *buffer.WaveSource {
+	const step = 1024
+	src := buffer.NewWaveSource()
+	go func() {
+		defer src.Close()
+		buf := make([]float64, 0, step)
+		for v := range input {
+			buf = append(buf, v)
+			if step <= len(buf) {
+				src.Append(buf)
+				buf = buf[:0]
+			}
+		}
+		src.Append(buf)
+	}()
+	return src
+}
+
+// newHarmony は、主声部と voices で指定した声部を生成する harmony を作成します。
+// 各声部のピッチは主声部のピッチシフトの比率に対する相対値となります。
+func newHarmony(input <-chan buffer.Shape, voices []Voice, ctrl *controller, config fft.Config, envOpts formant.EnvelopeOptions, fs, fsOut float64) *harmony {
+	voices = append([]Voice{{}}, voices...)
+	h := &harmony{
+		output: make(chan float64, 4096),
+	}
+	inputs := teeShapes(input, len(voices))
+	for i, v := range voices {
+		ratio := math.Pow(2.0, v.Interval/12.0)
+		pitchCoef := control.Func(func(t float64) float64 {
+			return ctrl.pitchRatio(t) * ratio
+		})
+		st := newStretcher(pitchCoef, control.Const(1), fsOut/fs, fs)
+		st.input = inputs[i]
+		h.stretchers = append(h.stretchers, st)
+		out := join(st.output)
+
+		// ストレッチャによるフォルマントのずれを打ち消し、指定したシフト量を加える（合成した伸縮が恒等写像となる場合は省略する）
+		if v.Formant != v.Interval || !isLinearWarp(envOpts.Warp) {
+			o := envOpts
+			o.InputScale = control.Const(ratio)
+			o.OutputScale = nil
+			o.Mapping = nil // 声質の補正・スペクトルの傾きは前段のフォルマントシフタで済んでいる
+			o.Tilt = nil
+			if o.F0 != nil {
+				f0 := o.F0
+				o.F0 = control.Func(func(t float64) float64 {
+					return f0.At(t) * pitchCoef.At(t)
+				})
+			}
+			sh := formant.NewShifter(feedWaveSource(out), int(fsOut), config, o, control.Const(math.Pow(2.0, v.Formant/12.0)))
+			h.shifters = append(h.shifters, sh)
+			out = sh.Output()
+		}
+		h.inputs = append(h.inputs, out)
+
+		gain := math.Pow(10.0, v.Gain/20.0)
+		h.gainL = append(h.gainL, gain*math.Min(1, 1-v.Pan))
+		h.gainR = append(h.gainR, gain*math.Min(1, 1+v.Pan))
+		log.Printf("debug: voice %d: interval=%.2f formant=%.2f gain=%.2fdB pan=%.2f", i, v.Interval, v.Formant, v.Gain, v.Pan)
+	}
+	return h
+}
+
+func (h *harmony) Start() {
+	for _, st := range h.stretchers {
+		st.Start()
+	}
+	for _, sh := range h.shifters {
+		sh.Start()
+	}
+	go func() {
+		log.Print("debug: harmony goroutine is started")
+		inputs := append([]<-chan float64{}, h.inputs...)
+		msg := 0
+		for {
+			l, r := .0, .0
+			alive := false
+			for i, in := range inputs {
+				if in == nil {
+					continue
+				}
+				v, ok := <-in
+				if !ok {
+					inputs[i] = nil
+					continue
+				}
+				alive = true
+				l += v * h.gainL[i]
+				r += v * h.gainR[i]
+			}
+			if !alive {
+				break
+			}
+			h.output <- l
+			h.output <- r
+			msg++
+		}
+		log.Printf("debug: harmony %d messages", msg)
+		close(h.output)
+	}()
+}
+
+// isLinearWarp は、周波数軸の伸縮方法 warp が線形であるかを返します。
+func isLinearWarp(warp formant.Warp) bool {
+	if warp == nil {
+		return true
+	}
+	_, ok := warp.(formant.LinearWarp)
+	return ok
+}
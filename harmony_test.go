@@ -0,0 +1,70 @@
+package voispire
+
+import (
+	"math"
+	"testing"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/fft"
+	"github.com/but80/voispire/internal/formant"
+	"github.com/but80/voispire/internal/gate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarmony(t *testing.T) {
+	const fs = 8000
+	const period = 100 // 80Hz
+	input := make(chan buffer.Shape, 256)
+	for i := 0; i < 200; i++ {
+		shape := make([]float64, period)
+		for j := range shape {
+			shape[j] = .3 * math.Sin(2*math.Pi*float64(j)/period)
+		}
+		input <- buffer.MakeShape(shape)
+	}
+	close(input)
+
+	ctrl := newController(Options{Transpose: 2}, true)
+	voices := []Voice{
+		{Interval: 12, Gain: -6, Pan: -1},
+		{Interval: -5, Gain: 0, Pan: 0},
+	}
+	h := newHarmony(input, voices, ctrl, fft.DefaultConfig, formant.EnvelopeOptions{}, fs, fs)
+
+	// 主声部に続いて各声部が並び、ピッチは主声部に対する相対値となる
+	assert.Equal(t, 3, len(h.stretchers))
+	main := math.Pow(2, 2.0/12)
+	for i, interval := range []float64{0, 12, -5} {
+		assert.InDelta(t, main*math.Pow(2, interval/12), h.stretchers[i].pitchCoef.At(0), 1e-9, "voice %d", i)
+	}
+	// 定位は反対側のみを減衰させる
+	half := math.Pow(10, -6.0/20)
+	assert.InDeltaSlice(t, []float64{1, half, 1}, h.gainL, 1e-9)
+	assert.InDeltaSlice(t, []float64{1, 0, 1}, h.gainR, 1e-9)
+	closed := make(chan buffer.Shape)
+	close(closed)
+	panned := newHarmony(closed, []Voice{{Interval: 3, Pan: .5}}, ctrl, fft.DefaultConfig, formant.EnvelopeOptions{}, fs, fs)
+	assert.InDeltaSlice(t, []float64{1, .5}, panned.gainL, 1e-9)
+	assert.InDeltaSlice(t, []float64{1, 1}, panned.gainR, 1e-9)
+
+	h.Start()
+	left, right := []float64{}, []float64{}
+	for {
+		l, ok := <-h.output
+		if !ok {
+			break
+		}
+		left = append(left, l)
+		right = append(right, <-h.output)
+	}
+	assert.True(t, fs < len(left), "len=%d", len(left))
+
+	// 左右の差には、右で減衰させた声部（主声部の1オクターブ上）のみが残る
+	n := len(left) / 2
+	diff := make([]float64, 1024)
+	for i := range diff {
+		diff[i] = left[n+i] - right[n+i]
+	}
+	lag, _ := gate.Periodicity(diff, 10, 400)
+	assert.InDelta(t, period/main/2, lag, 1, "lag=%f", lag)
+}
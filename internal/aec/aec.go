@@ -0,0 +1,136 @@
+package aec
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	// DefaultStep は、適応フィルタの標準のステップサイズです。
+	DefaultStep = .5
+	// minEnergy は、ステップサイズを正規化するときに参照信号のエネルギーとみなす下限です。
+	minEnergy = 1e-6
+	// minReferencePeak は、参照信号があるとみなす振幅の下限です。これより小さい間は適応を止めます。
+	minReferencePeak = 1e-4
+	// doubleTalkRatio は、入力の振幅が参照信号の直近の最大振幅のこの倍率を超えたとき、
+	// 話者の声が含まれる（ダブルトーク）とみなして適応を止める閾値です（Geigel法）。
+	doubleTalkRatio = 1.0
+)
+
+// Canceller は、正規化LMS法の適応フィルタで、入力（マイク）に含まれる参照信号（スピーカーから再生した音）のエコーを除去します。
+type Canceller struct {
+	weights []float64 // 適応フィルタの係数
+	history []float64 // 参照信号の直近のサンプル（新しい順に読めるよう2周分を保持するリングバッファ）
+	pos     int
+	energy  float64 // history に含まれる直近 len(weights) サンプルのエネルギー
+	step    float64
+	peak    float64 // 参照信号の直近の最大振幅（指数的に減衰）
+	decay   float64
+	hold    int // 適応を止めている残りサンプル数
+	queue   []float64
+	delay   int
+	mutex   sync.Mutex
+}
+
+// New は、長さ taps [サンプル] の適応フィルタを持つ Canceller を作成します。
+// delay は、 Render で与えた参照信号が Capture で入力と対応付けられるまでの遅延 [サンプル] で、
+// 出力から入力までのデバイスのレイテンシを補償します。同じ長さのブロックごとに Render, Capture の順で呼び出すものとします。
+// step は正規化LMS法のステップサイズ (0..2) です。
+func New(taps, delay int, step float64) *Canceller {
+	if taps < 1 {
+		taps = 1
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return &Canceller{
+		weights: make([]float64, taps),
+		history: make([]float64, taps*2),
+		step:    step,
+		decay:   math.Exp(-1 / float64(taps)),
+		queue:   make([]float64, delay),
+		delay:   delay,
+	}
+}
+
+// Process は、入力のサンプル mic と同時刻の参照信号のサンプル ref から、エコーを除去したサンプルを返します。
+func (c *Canceller) Process(mic, ref float64) float64 {
+	n := len(c.weights)
+	c.pos--
+	if c.pos < 0 {
+		c.pos = n - 1
+	}
+	old := c.history[c.pos]
+	c.history[c.pos] = ref
+	c.history[c.pos+n] = ref
+	c.energy = math.Max(0, c.energy+ref*ref-old*old)
+	x := c.history[c.pos : c.pos+n]
+
+	y := .0
+	for i, w := range c.weights {
+		y += w * x[i]
+	}
+	e := mic - y
+
+	c.peak = math.Max(math.Abs(ref), c.peak*c.decay)
+	if c.peak < minReferencePeak {
+		return e
+	}
+	if doubleTalkRatio*c.peak < math.Abs(mic) {
+		c.hold = n
+	}
+	if 0 < c.hold {
+		c.hold--
+		return e
+	}
+	g := c.step * e / (c.energy + minEnergy)
+	for i := range c.weights {
+		c.weights[i] += g * x[i]
+	}
+	return e
+}
+
+// Render は、再生した参照信号のサンプルを追加します。
+func (c *Canceller) Render(ref []float64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.queue = append(c.queue, ref...)
+	// 入力が止まっている間に参照信号が溜まり続けないよう、遅延と1フレーム分の余裕を超えた古いサンプルは捨てる
+	if max := c.delay + len(c.weights) + len(ref); max < len(c.queue) {
+		c.queue = append(c.queue[:0], c.queue[len(c.queue)-max:]...)
+	}
+}
+
+// Capture は、入力のサンプル mic からエコーを除去して dst に書き込みます。
+// 参照信号には Render で追加したサンプルを順に使用します。足りない分は無音とみなします。
+func (c *Canceller) Capture(dst, mic []float64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	m := len(mic)
+	if len(c.queue) < m {
+		m = len(c.queue)
+	}
+	for i, v := range mic {
+		ref := .0
+		if i < m {
+			ref = c.queue[i]
+		}
+		dst[i] = c.Process(v, ref)
+	}
+	c.queue = append(c.queue[:0], c.queue[m:]...)
+}
+
+// Cancel は、入力の波形 mic から、同時に再生した参照信号の波形 ref のエコーを除去した波形を返します。
+// ref が mic より短い場合、足りない分は無音とみなします。
+func Cancel(mic, ref []float64, taps int, step float64) []float64 {
+	c := New(taps, 0, step)
+	result := make([]float64, len(mic))
+	for i, v := range mic {
+		r := .0
+		if i < len(ref) {
+			r = ref[i]
+		}
+		result[i] = c.Process(v, r)
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+package aec
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rms(x []float64) float64 {
+	sum := .0
+	for _, v := range x {
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(x)))
+}
+
+// echo は、参照信号 ref が遅延 delay [サンプル] で減衰しながら反響したエコーを返します。
+func echo(ref []float64, delay int) []float64 {
+	ir := map[int]float64{delay: .6, delay + 7: -.3, delay + 23: .15, delay + 60: .05}
+	result := make([]float64, len(ref))
+	for i := range result {
+		for d, g := range ir {
+			if 0 <= i-d {
+				result[i] += g * ref[i-d]
+			}
+		}
+	}
+	return result
+}
+
+func TestCancel(t *testing.T) {
+	fs := 8000
+	r := rand.New(rand.NewSource(1))
+	ref := make([]float64, fs*3)
+	for i := range ref {
+		ref[i] = .3 * r.NormFloat64()
+	}
+	mic := echo(ref, 20)
+	// 2秒目以降は話者の声（正弦波）が重なる
+	voice := make([]float64, len(mic))
+	for i := fs * 2; i < len(mic); i++ {
+		voice[i] = .5 * math.Sin(2*math.Pi*300*float64(i)/float64(fs))
+		mic[i] += voice[i]
+	}
+	result := Cancel(mic, ref, 128, DefaultStep)
+
+	// 収束後はエコーが 20dB 以上減っている
+	assert.True(t, rms(result[fs:fs*2]) < rms(mic[fs:fs*2])*.1, "echo=%f residual=%f", rms(mic[fs:fs*2]), rms(result[fs:fs*2]))
+	// 話者の声は残る
+	residual := make([]float64, fs/2)
+	for i := range residual {
+		j := fs*5/2 + i
+		residual[i] = result[j] - voice[j]
+	}
+	assert.True(t, rms(residual) < rms(voice[fs*5/2:fs*3])*.2, "residual=%f", rms(residual))
+}
+
+func TestCanceller_Capture(t *testing.T) {
+	fs := 8000
+	r := rand.New(rand.NewSource(2))
+	ref := make([]float64, fs*2)
+	for i := range ref {
+		ref[i] = .3 * r.NormFloat64()
+	}
+	// 再生から入力まで 100 サンプルの遅延がある
+	mic := echo(append(make([]float64, 100), ref...), 10)[:len(ref)]
+	c := New(64, 100, DefaultStep)
+	result := make([]float64, len(mic))
+	const block = 256
+	for i := 0; i+block <= len(mic); i += block {
+		c.Render(ref[i : i+block])
+		c.Capture(result[i:i+block], mic[i:i+block])
+	}
+	n := len(mic) / block * block
+	assert.True(t, rms(result[n-fs/2:n]) < rms(mic[n-fs/2:n])*.1, "echo=%f residual=%f", rms(mic[n-fs/2:n]), rms(result[n-fs/2:n]))
+}
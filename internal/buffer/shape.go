@@ -134,6 +134,12 @@ func (buf *ShapeHistory) Rotate(s Shape) {
 	buf.shapes = append(buf.shapes[1:], s)
 }
 
+// Lag は、最初の Rotate で与えた波形を中心に置いたまま、何回の Rotate を経て入力に追従するかを返します。
+// Get から得られる波形は、入力に対して最初の波形のこの周期数分だけ遅延します。
+func (buf *ShapeHistory) Lag() int {
+	return sigmaWidth
+}
+
 // Freq は、現在バッファの中心にある波形のオリジナルの周波数を返します。
 func (buf *ShapeHistory) Freq() float64 {
 	return buf.shapes[sigmaWidth].freq
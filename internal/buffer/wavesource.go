@@ -11,6 +11,7 @@ type WaveSource struct {
 	buffer []float64
 	notify chan struct{}
 	closed bool
+	tees   []*WaveSource
 	mutex  sync.Mutex
 }
 
@@ -28,6 +29,9 @@ func (s *WaveSource) Append(data []float64) {
 	if s.closed {
 		return
 	}
+	for _, t := range s.tees {
+		t.Append(data)
+	}
 	c0 := cap(s.buffer)
 	s.buffer = append(s.buffer, data...)
 	c1 := cap(s.buffer)
@@ -43,8 +47,33 @@ func (s *WaveSource) Append(data []float64) {
 func (s *WaveSource) Close() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
 	close(s.notify)
 	s.closed = true
+	for _, t := range s.tees {
+		t.Close()
+	}
+}
+
+// Tee は、このバッファと同じソース波形が供給される新しい WaveSource を作成します。
+// 呼び出し時点でこのバッファに残っているソース波形も複製されます。
+func (s *WaveSource) Tee() *WaveSource {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	t := NewWaveSource()
+	t.index = s.index
+	t.buffer = append([]float64{}, s.buffer...)
+	if 0 < len(t.buffer) {
+		t.notify <- struct{}{}
+	}
+	if s.closed {
+		t.Close()
+	} else {
+		s.tees = append(s.tees, t)
+	}
+	return t
 }
 
 func (s *WaveSource) readAsync(begin, end int) ([]float64, bool) {
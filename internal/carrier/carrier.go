@@ -0,0 +1,115 @@
+package carrier
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/but80/voispire/internal/control"
+)
+
+// 発振器の波形
+const (
+	Saw    = "saw"
+	Square = "square"
+)
+
+// Oscillator は、帯域制限した（PolyBLEPによりエイリアシングを抑えた）のこぎり波または矩形波を生成します。
+type Oscillator struct {
+	wave  string
+	freq  control.Param
+	fs    float64
+	phase float64
+}
+
+// NewOscillator は、波形 wave（ Saw または Square ）、時刻 t [sec] における周波数 freq [Hz] の発振器を作成します。
+func NewOscillator(wave string, freq control.Param, fs int) *Oscillator {
+	return &Oscillator{
+		wave: wave,
+		freq: freq,
+		fs:   float64(fs),
+	}
+}
+
+// polyBLEP は、位相 phase における不連続点の補正量を返します。 dt は1サンプルあたりの位相の増分です。
+func polyBLEP(phase, dt float64) float64 {
+	switch {
+	case phase < dt:
+		p := phase / dt
+		return p + p - p*p - 1
+	case 1-dt < phase:
+		p := (phase - 1) / dt
+		return p*p + p + p + 1
+	}
+	return 0
+}
+
+// Next は、時刻 t [sec] における次のサンプル値を返します。
+func (o *Oscillator) Next(t float64) float64 {
+	dt := clamp(o.freq.At(t)/o.fs, 0, .5)
+	var v float64
+	switch o.wave {
+	case Square:
+		v = 1
+		if .5 <= o.phase {
+			v = -1
+		}
+		v += polyBLEP(o.phase, dt)
+		v -= polyBLEP(math.Mod(o.phase+.5, 1), dt)
+	default:
+		v = 2*o.phase - 1
+		v -= polyBLEP(o.phase, dt)
+	}
+	o.phase += dt
+	if 1 <= o.phase {
+		o.phase--
+	}
+	return v
+}
+
+// Noise は、白色雑音を生成します。
+type Noise struct {
+	rand *rand.Rand
+}
+
+// NewNoise は、新しい Noise を作成します。
+func NewNoise() *Noise {
+	return &Noise{rand: rand.New(rand.NewSource(1))}
+}
+
+// Next は、 -1..1 の一様乱数を返します。
+func (n *Noise) Next(t float64) float64 {
+	return n.rand.Float64()*2 - 1
+}
+
+// Loop は、波形を繰り返し再生します。
+type Loop struct {
+	wave []float64
+	step float64
+	pos  float64
+}
+
+// NewLoop は、サンプリング周波数 fsWave の波形 wave を、サンプリング周波数 fs で繰り返し再生する Loop を作成します。
+// wave は空であってはいけません。
+func NewLoop(wave []float64, fsWave, fs int) *Loop {
+	return &Loop{
+		wave: wave,
+		step: float64(fsWave) / float64(fs),
+	}
+}
+
+// Next は、次のサンプル値を線形補間して返します。
+func (l *Loop) Next(t float64) float64 {
+	n := len(l.wave)
+	i := int(l.pos)
+	f := l.pos - float64(i)
+	v := l.wave[i]*(1-f) + l.wave[(i+1)%n]*f
+	l.pos += l.step
+	for float64(n) <= l.pos {
+		l.pos -= float64(n)
+	}
+	return v
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
@@ -0,0 +1,34 @@
+package carrier
+
+import (
+	"math"
+	"testing"
+
+	"github.com/but80/voispire/internal/control"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOscillator(t *testing.T) {
+	fs := 8000
+	for _, wave := range []string{Saw, Square} {
+		o := NewOscillator(wave, control.Const(100), fs)
+		sum := .0
+		peak := .0
+		for i := 0; i < fs; i++ {
+			v := o.Next(float64(i) / float64(fs))
+			sum += v
+			peak = math.Max(peak, math.Abs(v))
+		}
+		assert.InDelta(t, 0, sum/float64(fs), 1e-2, wave) // 直流成分を含まない
+		assert.True(t, peak <= 1.0+1e-9, wave)
+	}
+}
+
+func TestLoop(t *testing.T) {
+	l := NewLoop([]float64{0, 1, 2, 3}, 8000, 16000)
+	result := []float64{}
+	for i := 0; i < 10; i++ {
+		result = append(result, l.Next(0))
+	}
+	assert.Equal(t, []float64{0, .5, 1, 1.5, 2, 2.5, 3, 1.5, 0, .5}, result)
+}
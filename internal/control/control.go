@@ -0,0 +1,194 @@
+package control
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/xerrors"
+)
+
+// Param は、変換中に変化しうるパラメータです。
+type Param interface {
+	// At は、入力の先頭からの時刻 t [sec] におけるパラメータの値を返します。
+	At(t float64) float64
+}
+
+// Const は、常に一定の値をとるパラメータです。
+type Const float64
+
+// At は、時刻によらず一定の値を返します。
+func (c Const) At(t float64) float64 {
+	return float64(c)
+}
+
+// Func は、関数をパラメータとして扱うための型です。
+type Func func(t float64) float64
+
+// At は、関数の値を返します。
+func (f Func) At(t float64) float64 {
+	return f(t)
+}
+
+// Value は、別のゴルーチンから実行中に変更可能なパラメータです。
+type Value struct {
+	bits uint64
+}
+
+// NewValue は、初期値 v を持つ新しい Value を作成します。
+func NewValue(v float64) *Value {
+	return &Value{bits: math.Float64bits(v)}
+}
+
+// Set は、値を変更します。
+func (v *Value) Set(x float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(x))
+}
+
+// Get は、現在の値を返します。
+func (v *Value) Get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+// At は、時刻によらず現在の値を返します。
+func (v *Value) At(t float64) float64 {
+	return v.Get()
+}
+
+// Smoother は、パラメータの急激な変化を指数関数的に追従させて滑らかにします。
+type Smoother struct {
+	current float64
+	tau     float64
+	coef    float64
+	started bool
+}
+
+// NewSmoother は、時定数 tau [sec] で追従する Smoother を作成します。
+// dt [sec] は Next を呼び出す間隔です。
+func NewSmoother(tau, dt float64) *Smoother {
+	coef := 1.0
+	if 0 < tau {
+		coef = 1 - math.Exp(-dt/tau)
+	}
+	return &Smoother{tau: tau, coef: coef}
+}
+
+// Next は、目標値 target に向けて1ステップ追従した値を返します。
+// 初回の呼び出しでは、目標値をそのまま返します。
+func (s *Smoother) Next(target float64) float64 {
+	if !s.started {
+		s.current = target
+		s.started = true
+		return target
+	}
+	s.current += (target - s.current) * s.coef
+	return s.current
+}
+
+// NextAfter は、前回の呼び出しから dt [sec] 経過したものとして、目標値 target に向けて追従した値を返します。
+// 呼び出し間隔が一定でない場合に使用します。
+func (s *Smoother) NextAfter(target, dt float64) float64 {
+	if !s.started || s.tau <= 0 {
+		return s.Next(target)
+	}
+	s.current += (target - s.current) * (1 - math.Exp(-dt/s.tau))
+	return s.current
+}
+
+// Timeline は、あらかじめ決められた時刻に値が切り替わるパラメータです。
+type Timeline struct {
+	initial float64
+	times   []float64
+	values  []float64
+}
+
+// NewTimeline は、最初の切り替えまでの値が initial である Timeline を作成します。
+func NewTimeline(initial float64) *Timeline {
+	return &Timeline{initial: initial}
+}
+
+// Add は、時刻 t [sec] に値を v に切り替えます。
+// t は直前に追加した時刻以上である必要があります。
+func (tl *Timeline) Add(t, v float64) {
+	tl.times = append(tl.times, t)
+	tl.values = append(tl.values, v)
+}
+
+// At は、時刻 t 以前で最後に切り替えられた値を返します。
+func (tl *Timeline) At(t float64) float64 {
+	i := sort.Search(len(tl.times), func(i int) bool {
+		return t < tl.times[i]
+	})
+	if i == 0 {
+		return tl.initial
+	}
+	return tl.values[i-1]
+}
+
+// Curve は、あらかじめ決められた時刻の値の間を線形補間するパラメータです。
+type Curve struct {
+	times  []float64
+	values []float64
+}
+
+// NewCurve は、空の Curve を作成します。
+func NewCurve() *Curve {
+	return &Curve{}
+}
+
+// Add は、時刻 t [sec] における値を v とします。
+// t は直前に追加した時刻以上である必要があります。
+func (c *Curve) Add(t, v float64) {
+	c.times = append(c.times, t)
+	c.values = append(c.values, v)
+}
+
+// At は、時刻 t の前後の値を線形補間して返します。
+// 最初の時刻より前は最初の値、最後の時刻より後は最後の値とし、値がひとつも無い場合は 0 を返します。
+func (c *Curve) At(t float64) float64 {
+	n := len(c.times)
+	if n == 0 {
+		return 0
+	}
+	i := sort.Search(n, func(i int) bool {
+		return t < c.times[i]
+	})
+	if i == 0 {
+		return c.values[0]
+	}
+	if i == n {
+		return c.values[n-1]
+	}
+	t0, t1 := c.times[i-1], c.times[i]
+	f := (t - t0) / (t1 - t0)
+	return c.values[i-1]*(1-f) + c.values[i]*f
+}
+
+// ParseCurve は、 "0.5" のような数値、または "0:0,2.5:1" のような「時刻[sec]:値」のカンマ区切りをパラメータに変換します。
+func ParseCurve(s string) (Param, error) {
+	if v, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+		return Const(v), nil
+	}
+	c := NewCurve()
+	for _, item := range strings.Split(s, ",") {
+		kv := strings.Split(strings.TrimSpace(item), ":")
+		if len(kv) != 2 {
+			return nil, xerrors.Errorf("invalid curve point: %q", item)
+		}
+		t, err := strconv.ParseFloat(kv[0], 64)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid time: %w", err)
+		}
+		v, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid value: %w", err)
+		}
+		if 0 < len(c.times) && t < c.times[len(c.times)-1] {
+			return nil, xerrors.Errorf("times must be in ascending order: %q", item)
+		}
+		c.Add(t, v)
+	}
+	return c, nil
+}
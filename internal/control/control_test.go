@@ -0,0 +1,90 @@
+package control
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSmoother(t *testing.T) {
+	tests := []struct {
+		name    string
+		tau     float64
+		targets []float64
+		want    []float64
+	}{
+		{"first value is returned as is", .1, []float64{3}, []float64{3}},
+		{"follows exponentially", .1, []float64{0, 1, 1}, []float64{0, 1 - math.Exp(-1), 1 - math.Exp(-2)}},
+		{"no smoothing without time constant", 0, []float64{0, 1, -1}, []float64{0, 1, -1}},
+	}
+	for _, tt := range tests {
+		s := NewSmoother(tt.tau, .1)
+		for i, target := range tt.targets {
+			assert.InDelta(t, tt.want[i], s.Next(target), 1e-9, "%s: step %d", tt.name, i)
+		}
+	}
+
+	// NextAfter は経過時間に応じて追従する
+	s := NewSmoother(.1, .1)
+	s.Next(0)
+	assert.InDelta(t, 1-math.Exp(-2), s.NextAfter(1, .2), 1e-9)
+	assert.InDelta(t, 1, NewSmoother(0, .1).NextAfter(1, .2), 1e-9)
+}
+
+func TestTimeline_At(t *testing.T) {
+	tl := NewTimeline(1)
+	tl.Add(1, 2)
+	tl.Add(2, 3)
+	tl.Add(2, 4) // 同時刻は後に追加した値が優先
+	tests := []struct {
+		t    float64
+		want float64
+	}{
+		{-1, 1},
+		{0, 1},
+		{.999, 1},
+		{1, 2},
+		{1.5, 2},
+		{2, 4},
+		{10, 4},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tl.At(tt.t), "t=%g", tt.t)
+	}
+	assert.Equal(t, 5.0, NewTimeline(5).At(0))
+}
+
+func TestParseCurve(t *testing.T) {
+	tests := []struct {
+		s     string
+		times []float64
+		want  []float64
+		err   bool
+	}{
+		{s: "0.5", times: []float64{0, 10}, want: []float64{.5, .5}},
+		{s: " -2 ", times: []float64{0}, want: []float64{-2}},
+		{s: "0:0,2:1", times: []float64{-1, 0, 1, 2, 3}, want: []float64{0, 0, .5, 1, 1}},
+		{s: "1:1, 2:3, 4:-1", times: []float64{0, 1.5, 3}, want: []float64{1, 2, 1}},
+		{s: "0:0,0:1", times: []float64{0, 1}, want: []float64{1, 1}},
+		{s: "0:0,2", err: true},
+		{s: "a:1", err: true},
+		{s: "0:b", err: true},
+		{s: "2:0,1:1", err: true},
+		{s: "", err: true},
+	}
+	for _, tt := range tests {
+		p, err := ParseCurve(tt.s)
+		if tt.err {
+			assert.Error(t, err, "%q", tt.s)
+			continue
+		}
+		if !assert.NoError(t, err, "%q", tt.s) {
+			continue
+		}
+		for i, at := range tt.times {
+			assert.InDelta(t, tt.want[i], p.At(at), 1e-9, "%q at %g", tt.s, at)
+		}
+	}
+	assert.Equal(t, .0, NewCurve().At(1))
+}
@@ -0,0 +1,85 @@
+package control
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// ParseOSC は、OSCパケットを解析し、含まれるメッセージごとに handler を呼び出します。
+// 各メッセージは先頭の数値引数のみを値として扱い、アドレスの最後の要素を名前とします。
+// 例えば "/voispire/formant ,f 3.0" は名前 "formant"、値 3.0 となります。
+func ParseOSC(packet []byte, handler Handler) error {
+	if bytes.HasPrefix(packet, []byte("#bundle\x00")) {
+		// #bundle, タイムタグ (8byte) に続いて、サイズ付きの要素が並ぶ
+		if len(packet) < 16 {
+			return xerrors.New("OSCバンドルのヘッダが不正です")
+		}
+		p := packet[16:]
+		for 4 <= len(p) {
+			n := int(binary.BigEndian.Uint32(p))
+			p = p[4:]
+			if len(p) < n {
+				return xerrors.New("OSCバンドルの要素サイズが不正です")
+			}
+			if err := ParseOSC(p[:n], handler); err != nil {
+				return err
+			}
+			p = p[n:]
+		}
+		return nil
+	}
+
+	addr, p, err := oscString(packet)
+	if err != nil {
+		return err
+	}
+	tags, p, err := oscString(p)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(tags, ",") {
+		return xerrors.Errorf("OSCメッセージの型タグが不正です: %s", addr)
+	}
+	for _, tag := range tags[1:] {
+		var v float64
+		switch tag {
+		case 'f':
+			if len(p) < 4 {
+				return xerrors.Errorf("OSCメッセージの引数が不足しています: %s", addr)
+			}
+			v = float64(math.Float32frombits(binary.BigEndian.Uint32(p)))
+		case 'i':
+			if len(p) < 4 {
+				return xerrors.Errorf("OSCメッセージの引数が不足しています: %s", addr)
+			}
+			v = float64(int32(binary.BigEndian.Uint32(p)))
+		case 'd':
+			if len(p) < 8 {
+				return xerrors.Errorf("OSCメッセージの引数が不足しています: %s", addr)
+			}
+			v = math.Float64frombits(binary.BigEndian.Uint64(p))
+		default:
+			return xerrors.Errorf("OSCメッセージの引数の型 %c には対応していません: %s", tag, addr)
+		}
+		handler(addr[strings.LastIndex(addr, "/")+1:], v)
+		return nil
+	}
+	return xerrors.Errorf("OSCメッセージに引数がありません: %s", addr)
+}
+
+// oscString は、4byte境界にパディングされたOSC文字列を読み込み、残りのデータとともに返します。
+func oscString(p []byte) (string, []byte, error) {
+	i := bytes.IndexByte(p, 0)
+	if i < 0 {
+		return "", nil, xerrors.New("OSC文字列が終端されていません")
+	}
+	n := (i + 4) &^ 3
+	if len(p) < n {
+		n = len(p)
+	}
+	return string(p[:i]), p[n:], nil
+}
@@ -0,0 +1,100 @@
+package control
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// oscPad は、OSC文字列として s を終端し、4byte境界までパディングします。
+func oscPad(s string) []byte {
+	b := append([]byte(s), 0)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func oscMessage(addr, tags string, args ...[]byte) []byte {
+	b := append(oscPad(addr), oscPad(tags)...)
+	for _, a := range args {
+		b = append(b, a...)
+	}
+	return b
+}
+
+func oscFloat(v float32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, math.Float32bits(v))
+	return b
+}
+
+func oscInt(v int32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(v))
+	return b
+}
+
+func oscDouble(v float64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(v))
+	return b
+}
+
+func oscBundle(elements ...[]byte) []byte {
+	b := append(oscPad("#bundle"), make([]byte, 8)...) // タイムタグ
+	for _, e := range elements {
+		b = append(b, oscInt(int32(len(e)))...)
+		b = append(b, e...)
+	}
+	return b
+}
+
+func TestParseOSC(t *testing.T) {
+	type call struct {
+		name  string
+		value float64
+	}
+	tests := []struct {
+		name   string
+		packet []byte
+		want   []call
+		err    bool
+	}{
+		{"float", oscMessage("/voispire/formant", ",f", oscFloat(3)), []call{{"formant", 3}}, false},
+		{"int", oscMessage("/transpose", ",i", oscInt(-5)), []call{{"transpose", -5}}, false},
+		{"double", oscMessage("/mix", ",d", oscDouble(.25)), []call{{"mix", .25}}, false},
+		{"first argument only", oscMessage("/a/b", ",fi", oscFloat(1), oscInt(2)), []call{{"b", 1}}, false},
+		{"no slash", oscMessage("formant", ",f", oscFloat(2)), []call{{"formant", 2}}, false},
+		{
+			"bundle",
+			oscBundle(oscMessage("/formant", ",f", oscFloat(1)), oscMessage("/transpose", ",i", oscInt(2))),
+			[]call{{"formant", 1}, {"transpose", 2}},
+			false,
+		},
+		{"nested bundle", oscBundle(oscBundle(oscMessage("/mix", ",f", oscFloat(.5)))), []call{{"mix", .5}}, false},
+		{"short bundle header", []byte("#bundle\x00"), nil, true},
+		{"bad bundle element size", append(oscBundle(), oscInt(100)...), nil, true},
+		{"unterminated address", []byte("/formant"), nil, true},
+		{"missing type tags", oscPad("/formant"), nil, true},
+		{"bad type tags", oscMessage("/formant", "f", oscFloat(1)), nil, true},
+		{"missing argument", oscMessage("/formant", ",f"), nil, true},
+		{"missing double argument", oscMessage("/formant", ",d", oscFloat(1)), nil, true},
+		{"unsupported type", oscMessage("/formant", ",s", oscPad("x")), nil, true},
+		{"no arguments", oscMessage("/formant", ","), nil, true},
+	}
+	for _, tt := range tests {
+		calls := []call{}
+		err := ParseOSC(tt.packet, func(name string, value float64) {
+			calls = append(calls, call{name, value})
+		})
+		if tt.err {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, calls, tt.name)
+	}
+}
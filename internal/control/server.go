@@ -0,0 +1,81 @@
+package control
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Handler は、名前 name のパラメータに値 value が指定されたときに呼ばれる関数です。
+type Handler func(name string, value float64)
+
+// ServeLines は、 r から "<name> <value>" 形式の行を読み込み、 handler を呼び出します。
+// r が終端に達するまでブロックします。
+func ServeLines(r io.Reader, handler Handler) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			log.Printf("warn: 不正なコマンドです: %s", line)
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			log.Printf("warn: 不正な値です: %s", line)
+			continue
+		}
+		handler(fields[0], v)
+	}
+}
+
+// ListenTCP は、 addr で待ち受け、接続ごとに ServeLines を実行するゴルーチンを開始します。
+func ListenTCP(addr string, handler Handler) (io.Closer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, xerrors.Errorf("コントロールソケットの待ち受けに失敗しました: %s: %w", addr, err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			log.Printf("info: コントロールソケットに接続されました: %s", conn.RemoteAddr())
+			go func() {
+				defer conn.Close()
+				ServeLines(conn, handler)
+			}()
+		}
+	}()
+	return ln, nil
+}
+
+// ListenOSC は、 addr でOSCパケットを待ち受けるゴルーチンを開始します。
+func ListenOSC(addr string, handler Handler) (io.Closer, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, xerrors.Errorf("OSCポートの待ち受けに失敗しました: %s: %w", addr, err)
+	}
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if err := ParseOSC(buf[:n], handler); err != nil {
+				log.Printf("warn: %s", err)
+			}
+		}
+	}()
+	return conn, nil
+}
@@ -0,0 +1,35 @@
+package control
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeLines(t *testing.T) {
+	type call struct {
+		name  string
+		value float64
+	}
+	tests := []struct {
+		name  string
+		input string
+		want  []call
+	}{
+		{"single", "formant 3\n", []call{{"formant", 3}}},
+		{"multiple", "formant 3\ntranspose -2.5\n", []call{{"formant", 3}, {"transpose", -2.5}}},
+		{"without trailing newline", "mix .5", []call{{"mix", .5}}},
+		{"surrounding spaces", "  formant\t1  \r\n", []call{{"formant", 1}}},
+		{"empty lines are skipped", "\n\nformant 1\n\n", []call{{"formant", 1}}},
+		{"invalid commands are skipped", "formant\nformant 1 2\nformant x\ntranspose 2\n", []call{{"transpose", 2}}},
+		{"empty", "", []call{}},
+	}
+	for _, tt := range tests {
+		calls := []call{}
+		ServeLines(strings.NewReader(tt.input), func(name string, value float64) {
+			calls = append(calls, call{name, value})
+		})
+		assert.Equal(t, tt.want, calls, tt.name)
+	}
+}
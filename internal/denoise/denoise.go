@@ -0,0 +1,144 @@
+package denoise
+
+import (
+	"log"
+	"math"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/fft"
+	"github.com/but80/voispire/internal/series"
+	"gonum.org/v1/gonum/fourier"
+)
+
+// 雑音の除去方法
+const (
+	MethodSubtract = "subtract"
+	MethodWiener   = "wiener"
+)
+
+// wienerSmoothing は、Wienerフィルタの事前SN比の推定（decision-directed法）における前フレームの重みです。
+// 1 に近いほどゲインの時間変化が滑らかになり、ミュージカルノイズが減ります。
+const wienerSmoothing = .98
+
+// Options は、雑音除去のオプションです。
+type Options struct {
+	// Method は、雑音の除去方法（ MethodSubtract または MethodWiener ）です。空のときは MethodWiener とします。
+	Method string
+	// Amount は、雑音のパワースペクトルにかける倍率です。大きいほど強く除去します。0 のときは 1 とします。
+	Amount float64
+	// Floor は、各周波数のゲインの下限 [dB] です（例: -20）。
+	Floor float64
+	// Profile は、雑音のパワースペクトル（周波数 [bin] ごと）です。nil のときは入力の先頭から学習します。
+	Profile []float64
+	// LearnTime は、 Profile が nil のときに雑音を学習する入力の先頭の長さ [sec] です。
+	// この間は入力をそのまま出力します。
+	LearnTime float64
+}
+
+// powerSpectra は、波形 wave をフレームごとに分析し、周波数 [bin] ごとのパワーを fn に渡します。
+func powerSpectra(wave []float64, config fft.Config, fn func(power []float64)) {
+	width := config.Width
+	window, err := series.Named(config.Window, width)
+	if err != nil {
+		panic(err)
+	}
+	f := fourier.NewFFT(width)
+	wave0 := make([]float64, width)
+	spec := make([]complex128, width/2+1)
+	power := make([]float64, width/2+1)
+	for i := 0; i+width <= len(wave); i += config.Step() {
+		window.Apply(wave0, wave[i:i+width])
+		f.Coefficients(spec, wave0)
+		series.CmplxDivFloatConst(spec, spec, float64(width))
+		for k, c := range spec {
+			power[k] = real(c)*real(c) + imag(c)*imag(c)
+		}
+		fn(power)
+	}
+}
+
+// LearnProfile は、サンプリング周波数 fsWave の雑音のみの波形 wave から、
+// サンプリング周波数 fs の入力に対する雑音のパワースペクトルを求めます。
+// wave がフレーム幅より短い場合は nil を返します。
+func LearnProfile(wave []float64, fsWave, fs int, config fft.Config) []float64 {
+	n := config.Width/2 + 1
+	sum := make([]float64, n)
+	frames := 0
+	powerSpectra(wave, config, func(power []float64) {
+		for k, p := range power {
+			sum[k] += p
+		}
+		frames++
+	})
+	if frames == 0 {
+		return nil
+	}
+	// 入力の各binの周波数に対応する位置で補間する
+	profile := make([]float64, n)
+	for k := range profile {
+		j := float64(k) * float64(fs) / float64(fsWave)
+		j0 := int(j)
+		if n-1 <= j0 {
+			profile[k] = sum[n-1] / float64(frames)
+			continue
+		}
+		f := j - float64(j0)
+		profile[k] = (sum[j0]*(1-f) + sum[j0+1]*f) / float64(frames)
+	}
+	return profile
+}
+
+// New は、入力の雑音をスペクトル減算またはWienerフィルタで除去する fft.Processor を作成します。
+func New(input *buffer.WaveSource, fs int, config fft.Config, o Options) fft.Processor {
+	n := config.Width/2 + 1
+	amount := o.Amount
+	if amount <= 0 {
+		amount = 1
+	}
+	floor := math.Pow(10, o.Floor/20)
+	noise := o.Profile
+	learnFrames := 0
+	if noise == nil {
+		noise = make([]float64, n)
+		learnFrames = int(o.LearnTime * float64(fs) / float64(config.Step()))
+		log.Printf("debug: learning noise profile from the first %d frames", learnFrames)
+	}
+	frame := 0
+	spec1 := make([]complex128, n)
+	prevGain := make([]float64, n) // 前フレームのゲイン
+	prevPower := make([]float64, n)
+	for k := range prevGain {
+		prevGain[k] = 1
+	}
+	return fft.NewProcessor(input, config, func(spec0 []complex128, wave0 []float64) []complex128 {
+		frame++
+		if frame <= learnFrames {
+			for k, c := range spec0 {
+				noise[k] += (real(c)*real(c) + imag(c)*imag(c)) / float64(learnFrames)
+			}
+			return spec0
+		}
+		for k, c := range spec0 {
+			p := real(c)*real(c) + imag(c)*imag(c)
+			nk := noise[k] * amount
+			gain := 1.0
+			switch {
+			case nk <= 0:
+			case p <= 0:
+				gain = floor
+			case o.Method == MethodSubtract:
+				gain = math.Sqrt(math.Max(0, 1-nk/p))
+			default:
+				// decision-directed法で事前SN比を推定
+				post := p / nk
+				prior := wienerSmoothing*prevGain[k]*prevGain[k]*prevPower[k]/nk + (1-wienerSmoothing)*math.Max(0, post-1)
+				gain = prior / (1 + prior)
+			}
+			gain = math.Max(floor, gain)
+			prevGain[k] = gain
+			prevPower[k] = p
+			spec1[k] = c * complex(gain, 0)
+		}
+		return spec1
+	})
+}
@@ -0,0 +1,59 @@
+package denoise
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/fft"
+	"github.com/stretchr/testify/assert"
+)
+
+func rms(x []float64) float64 {
+	sum := .0
+	for _, v := range x {
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(x)))
+}
+
+func TestNew(t *testing.T) {
+	fs := 16000
+	r := rand.New(rand.NewSource(1))
+	noise := func(n int) []float64 {
+		x := make([]float64, n)
+		for i := range x {
+			x[i] = .05 * r.NormFloat64()
+		}
+		return x
+	}
+	// 先頭0.5秒は雑音のみ、その後は正弦波に雑音が重なる
+	src := noise(fs * 2)
+	for i := fs / 2; i < len(src); i++ {
+		src[i] += .5 * math.Sin(2*math.Pi*440*float64(i)/float64(fs))
+	}
+	clip := noise(fs)
+
+	for _, method := range []string{MethodSubtract, MethodWiener} {
+		for _, profile := range [][]float64{nil, LearnProfile(clip, fs, fs, fft.DefaultConfig)} {
+			input := buffer.NewWaveSource()
+			input.Append(src)
+			input.Close()
+			p := New(input, fs, fft.DefaultConfig, Options{Method: method, Floor: -30, Profile: profile, LearnTime: .4})
+			p.Start()
+			result := []float64{}
+			for v := range p.Output() {
+				result = append(result, v)
+			}
+
+			// 正弦波の区間で、正弦波以外の成分（雑音）が 3dB 以上減っている
+			residual := make([]float64, fs/2)
+			for i := range residual {
+				j := fs + i
+				residual[i] = result[j] - .5*math.Sin(2*math.Pi*440*float64(j)/float64(fs))
+			}
+			assert.True(t, rms(residual) < .05*.7, "method=%s profile=%v residual=%f", method, profile != nil, rms(residual))
+		}
+	}
+}
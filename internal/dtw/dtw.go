@@ -0,0 +1,95 @@
+package dtw
+
+import "math"
+
+// distance は、特徴量 x, y のユークリッド距離を返します。
+func distance(x, y []float64) float64 {
+	d := .0
+	for i := range x {
+		e := x[i] - y[i]
+		d += e * e
+	}
+	return math.Sqrt(d)
+}
+
+// 経路の直前のセルの方向
+const (
+	fromDiag = iota
+	fromA
+	fromB
+)
+
+// Path は、特徴量の系列 a, b を動的時間伸縮 (DTW) で対応付けた経路を返します。
+// 経路は (a の位置, b の位置) の組を先頭から順に並べたもので、 (0, 0) に始まり (len(a)-1, len(b)-1) で終わります。
+func Path(a, b [][]float64) [][2]int {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return nil
+	}
+	cost := make([]float64, n*m)
+	from := make([]byte, n*m)
+	for i := 0; i < n; i++ {
+		for j := 0; j < m; j++ {
+			d := distance(a[i], b[j])
+			k := i*m + j
+			switch {
+			case i == 0 && j == 0:
+				cost[k] = d
+			case i == 0:
+				cost[k], from[k] = cost[k-1]+d, fromB
+			case j == 0:
+				cost[k], from[k] = cost[k-m]+d, fromA
+			default:
+				// 斜めの移動は2フレーム分の距離とみなし、縦横の移動に偏らないようにする
+				c, f := cost[k-m-1]+2*d, byte(fromDiag)
+				if v := cost[k-m] + d; v < c {
+					c, f = v, fromA
+				}
+				if v := cost[k-1] + d; v < c {
+					c, f = v, fromB
+				}
+				cost[k], from[k] = c, f
+			}
+		}
+	}
+	path := [][2]int{}
+	i, j := n-1, m-1
+	for {
+		path = append(path, [2]int{i, j})
+		if i == 0 && j == 0 {
+			break
+		}
+		switch from[i*m+j] {
+		case fromDiag:
+			i--
+			j--
+		case fromA:
+			i--
+		case fromB:
+			j--
+		}
+	}
+	for l, r := 0, len(path)-1; l < r; l, r = l+1, r-1 {
+		path[l], path[r] = path[r], path[l]
+	}
+	return path
+}
+
+// Align は、特徴量の系列 a, b を動的時間伸縮で対応付け、 a の各位置に対応する b の位置を返します。
+// a の1つの位置が b の複数の位置に対応する場合は、その平均とします。
+func Align(a, b [][]float64) []float64 {
+	path := Path(a, b)
+	if path == nil {
+		return nil
+	}
+	sum := make([]float64, len(a))
+	count := make([]int, len(a))
+	for _, p := range path {
+		sum[p[0]] += float64(p[1])
+		count[p[0]]++
+	}
+	for i := range sum {
+		sum[i] /= float64(count[i])
+	}
+	return sum
+}
@@ -0,0 +1,21 @@
+package dtw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlign(t *testing.T) {
+	a := [][]float64{{0}, {1}, {2}, {3}, {4}}
+	// b は a の 2, 3 番目を引き伸ばしたもの
+	b := [][]float64{{0}, {1}, {2}, {2}, {2}, {3}, {3}, {4}}
+
+	path := Path(a, b)
+	assert.Equal(t, [2]int{0, 0}, path[0])
+	assert.Equal(t, [2]int{4, 7}, path[len(path)-1])
+
+	assert.Equal(t, []float64{0, 1, 3, 5.5, 7}, Align(a, b))
+	assert.Equal(t, []float64{0, 1, 2, 2, 2, 3, 3, 4}, Align(b, a))
+	assert.Nil(t, Align(a, nil))
+}
@@ -0,0 +1,147 @@
+package f0track
+
+import (
+	"math"
+	"sort"
+)
+
+// Track は、時刻付きの基本周波数の系列です。
+type Track struct {
+	// Times は、各フレームの時刻 [sec] です。昇順に並んでいる必要があります。
+	Times []float64
+	// Values は、各フレームの基本周波数 [Hz] です。無声のフレームでは 0 となります。
+	Values []float64
+}
+
+// New は、各フレームの時刻 times [sec] と基本周波数 values [Hz] から Track を作成します。
+func New(times, values []float64) *Track {
+	if len(times) != len(values) {
+		panic("length mismatch")
+	}
+	return &Track{Times: times, Values: values}
+}
+
+// FromHarvest は、 world.Harvest の戻り値（基本周波数 f0 [Hz]、各フレームの時刻 times [sec] の順）から Track を作成します。
+// 引数の順が New と逆であることに注意してください。 f0track.FromHarvest(world.Harvest(...)) のように使用します。
+func FromHarvest(f0, times []float64) *Track {
+	return New(times, f0)
+}
+
+// Len は、フレーム数を返します。
+func (tr *Track) Len() int {
+	return len(tr.Times)
+}
+
+// Voiced は、フレーム i が有声かどうかを返します。
+func (tr *Track) Voiced(i int) bool {
+	return 0 < tr.Values[i]
+}
+
+// At は、時刻 t [sec] における基本周波数 [Hz] と、有声かどうかを返します。
+// 前後のフレームがともに有声の場合は線形補間し、それ以外の場合は近い方のフレームに従います。
+// 系列の範囲外の時刻は無声として扱います。
+func (tr *Track) At(t float64) (float64, bool) {
+	n := len(tr.Times)
+	if n == 0 || t < tr.Times[0] || tr.Times[n-1] < t {
+		return 0, false
+	}
+	// Times[i-1] ≦ t ＜ Times[i] となる i
+	i := sort.Search(n, func(i int) bool {
+		return t < tr.Times[i]
+	})
+	if i == n {
+		return tr.Values[n-1], tr.Voiced(n - 1)
+	}
+	i0, i1 := i-1, i
+	f := (t - tr.Times[i0]) / (tr.Times[i1] - tr.Times[i0])
+	if tr.Voiced(i0) && tr.Voiced(i1) {
+		return tr.Values[i0]*(1-f) + tr.Values[i1]*f, true
+	}
+	if f < .5 {
+		return tr.Values[i0], tr.Voiced(i0)
+	}
+	return tr.Values[i1], tr.Voiced(i1)
+}
+
+// Freq は、時刻 t [sec] における基本周波数 [Hz] を返します。無声の場合は 0 を返します。
+func (tr *Track) Freq(t float64) float64 {
+	v, _ := tr.At(t)
+	return v
+}
+
+// LogStats は、有声フレームにおける基本周波数の自然対数の平均と標準偏差を返します。
+// 有声フレームがない場合、 ok は false となります。
+func (tr *Track) LogStats() (mean, std float64, ok bool) {
+	n := 0
+	for i, v := range tr.Values {
+		if tr.Voiced(i) {
+			mean += math.Log(v)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, 0, false
+	}
+	mean /= float64(n)
+	for i, v := range tr.Values {
+		if tr.Voiced(i) {
+			d := math.Log(v) - mean
+			std += d * d
+		}
+	}
+	std = math.Sqrt(std / float64(n))
+	return mean, std, true
+}
+
+// index は、時刻 t [sec] に最も近いフレームの位置を返します。
+func (tr *Track) index(t float64) int {
+	n := len(tr.Times)
+	i := sort.Search(n, func(i int) bool {
+		return t < tr.Times[i]
+	})
+	if i == n || 0 < i && t-tr.Times[i-1] < tr.Times[i]-t {
+		i--
+	}
+	return i
+}
+
+// Onset は、時刻 t [sec] を含む有声区間の開始時刻 [sec] を返します。
+// t に最も近いフレームが無声の場合や系列の範囲外の場合、 ok は false となります。
+func (tr *Track) Onset(t float64) (float64, bool) {
+	n := len(tr.Times)
+	if n == 0 || t < tr.Times[0] || tr.Times[n-1] < t {
+		return 0, false
+	}
+	i := tr.index(t)
+	if !tr.Voiced(i) {
+		return 0, false
+	}
+	for 0 < i && tr.Voiced(i-1) {
+		i--
+	}
+	return tr.Times[i], true
+}
+
+// Smooth は、基本周波数の自然対数を、同じ有声区間内の前後 window/2 [sec] のフレームで移動平均した Track を返します。
+// 無声のフレームは無声のままとします。
+func (tr *Track) Smooth(window float64) *Track {
+	n := len(tr.Values)
+	values := make([]float64, n)
+	for i := range values {
+		if !tr.Voiced(i) {
+			continue
+		}
+		sum := .0
+		count := 0
+		for j := i; 0 <= j && tr.Voiced(j) && tr.Times[i]-tr.Times[j] <= window/2; j-- {
+			sum += math.Log(tr.Values[j])
+			count++
+		}
+		for j := i + 1; j < n && tr.Voiced(j) && tr.Times[j]-tr.Times[i] <= window/2; j++ {
+			sum += math.Log(tr.Values[j])
+			count++
+		}
+		values[i] = math.Exp(sum / float64(count))
+	}
+	return New(tr.Times, values)
+}
@@ -0,0 +1,93 @@
+package f0track
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrack_At(t *testing.T) {
+	tr := New(
+		[]float64{0, .005, .010, .015, .020},
+		[]float64{100, 200, 0, 0, 300},
+	)
+
+	v, ok := tr.At(.0025)
+	assert.True(t, ok)
+	assert.InDelta(t, 150, v, 1e-9) // interpolated
+	v, ok = tr.At(.005)
+	assert.True(t, ok)
+	assert.InDelta(t, 200, v, 1e-9)
+	v, ok = tr.At(.006) // nearest: voiced
+	assert.True(t, ok)
+	assert.InDelta(t, 200, v, 1e-9)
+	_, ok = tr.At(.009) // nearest: unvoiced
+	assert.False(t, ok)
+	v, ok = tr.At(.020)
+	assert.True(t, ok)
+	assert.InDelta(t, 300, v, 1e-9)
+	_, ok = tr.At(-.001)
+	assert.False(t, ok)
+	_, ok = tr.At(.021)
+	assert.False(t, ok)
+}
+
+func TestTrack_LogStats(t *testing.T) {
+	tr := New(
+		[]float64{0, .005, .010, .015},
+		[]float64{100, 0, 400, 0},
+	)
+	mean, std, ok := tr.LogStats()
+	assert.True(t, ok)
+	assert.InDelta(t, math.Log(200), mean, 1e-9)
+	assert.InDelta(t, math.Log(2), std, 1e-9)
+
+	_, _, ok = New([]float64{0}, []float64{0}).LogStats()
+	assert.False(t, ok)
+}
+
+func TestTrack_Onset(t *testing.T) {
+	tr := New(
+		[]float64{0, .005, .010, .015, .020, .025},
+		[]float64{0, 100, 110, 0, 120, 130},
+	)
+	v, ok := tr.Onset(.011)
+	assert.True(t, ok)
+	assert.InDelta(t, .005, v, 1e-9)
+	v, ok = tr.Onset(.024)
+	assert.True(t, ok)
+	assert.InDelta(t, .020, v, 1e-9)
+	_, ok = tr.Onset(.016)
+	assert.False(t, ok)
+	_, ok = tr.Onset(.030)
+	assert.False(t, ok)
+}
+
+func TestTrack_Smooth(t *testing.T) {
+	tr := New(
+		[]float64{0, .01, .02, .03, .04, .05},
+		[]float64{100, 400, 100, 400, 0, 200},
+	)
+	s := tr.Smooth(.025)
+	assert.InDelta(t, 200, s.Values[0], 1e-9)                    // 100, 400 の対数平均
+	assert.InDelta(t, math.Cbrt(100*400*100), s.Values[1], 1e-9) // 100, 400, 100
+	assert.InDelta(t, math.Cbrt(400*100*400), s.Values[2], 1e-9) // 400, 100, 400
+	assert.InDelta(t, 0, s.Values[4], 1e-9)
+	assert.InDelta(t, 200, s.Values[5], 1e-9) // 無声のフレームを挟んだ値は使わない
+}
+
+func TestFromHarvest(t *testing.T) {
+	// world.Harvest と同じく、基本周波数・時刻の順で渡す。最後のフレームは無声
+	f0 := []float64{0, 100, 200, 0}
+	times := []float64{0, .005, .010, .015}
+	tr := FromHarvest(f0, times)
+
+	assert.Equal(t, times, tr.Times)
+	assert.Equal(t, f0, tr.Values)
+	v, ok := tr.At(.0075)
+	assert.True(t, ok)
+	assert.InDelta(t, 150, v, 1e-9)
+	assert.InDelta(t, 200, tr.Freq(.010), 1e-9)
+	assert.Equal(t, .0, tr.Freq(.015))
+}
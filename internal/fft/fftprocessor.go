@@ -4,7 +4,9 @@ import (
 	"log"
 
 	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/onset"
 	"github.com/but80/voispire/internal/series"
+	"golang.org/x/xerrors"
 	"gonum.org/v1/gonum/fourier"
 )
 
@@ -12,24 +14,102 @@ import (
 type Processor interface {
 	Output() <-chan float64
 	OnFinish(func())
+	// PreserveTransients は、音の立ち上がり（オンセット）を含むフレームを加工せずに出力し、過渡音のプリエコーを防ぎます。
+	// スペクトルフラックスが threshold を超えたフレームから、そのオンセットを含む Overlap 個のフレームが対象となります。
+	// callback は、オンセットを検出するたびに、オンセットを含むフレームの最後の Step() サンプルの開始位置 [サンプル] と
+	// そのフレームの周波数スペクトルを渡して呼び出され、 true を返した場合のみ加工せずに出力します。
+	// 有声音の立ち上がりなど、加工を省くと前後のフレームとの違いが目立つオンセットを除外するために使用します。
+	PreserveTransients(threshold float64, callback func(i int, spec []complex128) bool)
 	Start()
 }
 
+// Config は、 Processor のフレームの設定です。
+type Config struct {
+	// Width は、FFTのサイズ [サンプル] です。2の累乗である必要があります。
+	Width int
+	// Overlap は、1つのサンプルに重なるフレームの数です。フレームをずらす幅は Width / Overlap となります。
+	Overlap int
+	// Window は、分析・合成に用いる窓関数の名前です（ series.Named を参照）。
+	Window string
+}
+
+// DefaultConfig は、既定のフレームの設定です。
+var DefaultConfig = Config{
+	Width:   1024,
+	Overlap: 2,
+	Window:  "sqrthann",
+}
+
+// Step は、フレームをずらす幅 [サンプル] を返します。
+func (c Config) Step() int {
+	return c.Width / c.Overlap
+}
+
+// Validate は、設定が有効かどうかを検査します。
+func (c Config) Validate() error {
+	if c.Width < 64 || c.Width&(c.Width-1) != 0 {
+		return xerrors.Errorf("FFT size must be a power of 2 and at least 64: %d", c.Width)
+	}
+	if c.Overlap != 2 && c.Overlap != 4 && c.Overlap != 8 {
+		return xerrors.Errorf("overlap must be 2, 4 or 8: %d", c.Overlap)
+	}
+	if _, err := series.Named(c.Window, c.Width); err != nil {
+		return err
+	}
+	return nil
+}
+
 type fftProcessor struct {
 	fft       *fourier.FFT
 	input     *buffer.WaveSource
 	output    chan float64
 	width     int
+	step      int
+	wa        series.Window
+	ws        series.Window
 	processor func([]complex128, []float64) []complex128
 	onFinish  func()
+	onset     *onset.Detector
+	onOnset   func(i int, spec []complex128) bool
+}
+
+// colaWindow は、分析窓関数 wa と組み合わせたときに、フレームを step ずつずらして重ね合わせた結果が
+// 1 となるよう（COLA条件）、合成窓関数 ws を正規化したものを返します。
+func colaWindow(wa, ws series.Window, step int) series.Window {
+	sum := make([]float64, step)
+	for i := range ws {
+		sum[i%step] += wa[i] * ws[i]
+	}
+	result := make(series.Window, len(ws))
+	for i, w := range ws {
+		if s := sum[i%step]; s != 0 {
+			result[i] = w / s
+		}
+	}
+	return result
 }
 
 // NewProcessor は、新しい Processor を作成します。
-func NewProcessor(input *buffer.WaveSource, width int, processor func([]complex128, []float64) []complex128) Processor {
+// config が不正な場合は panic します。
+func NewProcessor(input *buffer.WaveSource, config Config, processor func([]complex128, []float64) []complex128) Processor {
+	if err := config.Validate(); err != nil {
+		panic(err)
+	}
+	// 窓関数の選び方について
+	// - https://www.jstage.jst.go.jp/article/jasj/72/12/72_764/_pdf
+	//   「3.2 完全再構成条件」
+	// - https://jp.mathworks.com/help/signal/ref/iscola.html
+	//   「ルート-ハン ウィンドウの COLA 準拠の確認」
+	// 任意の窓関数・重なりの数で完全再構成となるよう、合成窓関数を正規化する
+	wa, _ := series.Named(config.Window, config.Width) // 分析窓関数
+	ws, _ := series.Named(config.Window, config.Width) // 合成窓関数
 	return &fftProcessor{
-		fft:       fourier.NewFFT(width),
+		fft:       fourier.NewFFT(config.Width),
 		input:     input,
-		width:     width,
+		width:     config.Width,
+		step:      config.Step(),
+		wa:        wa,
+		ws:        colaWindow(wa, ws, config.Step()),
 		processor: processor,
 		output:    make(chan float64, 4096),
 	}
@@ -43,56 +123,89 @@ func (s *fftProcessor) OnFinish(callback func()) {
 	s.onFinish = callback
 }
 
+func (s *fftProcessor) PreserveTransients(threshold float64, callback func(i int, spec []complex128) bool) {
+	s.onset = onset.New(threshold)
+	s.onOnset = callback
+}
+
 func (s *fftProcessor) Start() {
 	go func() {
 		log.Print("debug: fftProcessor goroutine is started")
 
-		step := s.width / 2                      // フレームをずらす幅（フレーム自体の幅の半分）
+		step := s.step                           // フレームをずらす幅
 		wave0 := make([]float64, s.width)        // 1フレーム分のソース時間波形
 		spec0 := make([]complex128, s.width/2+1) // 1フレーム分のソース周波数スペクトル
 		wave1 := make([]float64, s.width)        // wave0 を加工した結果
-		wave1Prev := make([]float64, s.width)    // 直前のフレームの wave1
-
-		// 窓関数の選び方について
-		// - https://www.jstage.jst.go.jp/article/jasj/72/12/72_764/_pdf
-		//   「3.2 完全再構成条件」
-		// - https://jp.mathworks.com/help/signal/ref/iscola.html
-		//   「ルート-ハン ウィンドウの COLA 準拠の確認」
-		wa := series.SqrtHann(s.width) // 分析窓関数
-		ws := series.SqrtHann(s.width) // 合成窓関数
+		sum := make([]float64, s.width)          // 重なり合うフレームの wave1 の和
+		dry := make([]float64, s.width)          // 加工せずに出力するフレームの wave0 の複製
+		dryFrames := 0                           // 加工せずに出力する残りのフレーム数
+		transients := 0
+		n := -1 // 入力の長さ（供給ソースがクローズするまでは -1）
 
 		i := 0
 		for {
 			src, cont := s.input.Read(i, i+s.width)
 			if !cont {
+				// 入力の末尾を越える部分は無音とみなす
+				n = i + len(src)
 				src = series.ExtendFloatSlice(src, s.width-len(src))
 			}
 
 			// 窓がけして周波数スペクトルを作成
-			wa.Apply(wave0, src)
+			s.wa.Apply(wave0, src)
 			s.fft.Coefficients(spec0, wave0)
 			series.CmplxDivFloatConst(spec0, spec0, float64(s.fft.Len())) // 振幅を調整
 
+			// オンセットを検出したら、それを含むフレームを加工せずに出力する
+			if s.onset != nil && s.onset.Detect(spec0) && s.onOnset(i+s.width-step, spec0) {
+				dryFrames = s.width / step
+				transients++
+			}
+			if 0 < dryFrames {
+				copy(dry, wave0)
+			}
+
 			// 周波数スペクトルを加工処理
+			// 加工しないフレームでも、処理器の状態を進めるために呼び出す
 			spec1 := s.processor(spec0, wave0)
 
 			// 時間領域に戻して窓がけ
-			s.fft.Sequence(wave1, spec1)
-			ws.Apply(wave1, wave1)
+			if 0 < dryFrames {
+				// 分析窓をかけたソース波形をそのまま合成すると、前後の加工したフレームと窓の重なりでクロスフェードする
+				copy(wave1, dry)
+				dryFrames--
+			} else {
+				s.fft.Sequence(wave1, spec1)
+			}
+			s.ws.Apply(wave1, wave1)
 
-			// 直前のフレームと合成しながら出力
-			prev := wave1Prev[step:]
-			for i := 0; i < step; i++ {
-				s.output <- prev[i] + wave1[i]
+			// 直前までのフレームと合成しながら出力
+			for j, v := range wave1 {
+				sum[j] += v
+			}
+			// 入力の末尾より後ろは出力しない
+			m := step
+			if 0 <= n && n < i+step {
+				m = n - i
+			}
+			for j := 0; j < m; j++ {
+				s.output <- sum[j]
+			}
+			copy(sum, sum[step:])
+			for j := s.width - step; j < s.width; j++ {
+				sum[j] = 0
 			}
 
 			s.input.DiscardUntil(i)
-			if !cont {
+			// 入力の末尾まで、全てのフレームが重なり終えたら終了
+			if 0 <= n && n <= i+step {
 				break
 			}
-			wave1, wave1Prev = wave1Prev, wave1
 			i += step
 		}
+		if s.onset != nil {
+			log.Printf("debug: fftProcessor %d transients", transients)
+		}
 		if s.onFinish != nil {
 			s.onFinish()
 		}
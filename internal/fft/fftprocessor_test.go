@@ -0,0 +1,97 @@
+package fft
+
+import (
+	"math"
+	"testing"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/series"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessor_reconstruction(t *testing.T) {
+	const n = 8192 + 100 // フレームをずらす幅の整数倍でない長さ
+	src := make([]float64, n)
+	for i := range src {
+		src[i] = math.Sin(float64(i)*.05) + .5*math.Sin(float64(i)*.31)
+	}
+	for _, window := range series.WindowNames() {
+		for _, overlap := range []int{2, 4, 8} {
+			config := Config{Width: 512, Overlap: overlap, Window: window}
+			input := buffer.NewWaveSource()
+			input.Append(src)
+			input.Close()
+			p := NewProcessor(input, config, func(spec0 []complex128, wave0 []float64) []complex128 {
+				return spec0
+			})
+			p.Start()
+			result := []float64{}
+			for v := range p.Output() {
+				result = append(result, v)
+			}
+
+			// 出力は入力と同じ長さで、先頭以外は加工しなければ入力と一致する（末尾まで欠けない）
+			assert.Equal(t, n, len(result), "window=%s overlap=%d", window, overlap)
+			maxErr := .0
+			for i := config.Width; i < n; i++ {
+				maxErr = math.Max(maxErr, math.Abs(result[i]-src[i]))
+			}
+			assert.True(t, maxErr < 1e-9, "window=%s overlap=%d error=%g", window, overlap, maxErr)
+		}
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, DefaultConfig.Validate())
+	assert.Error(t, Config{Width: 1000, Overlap: 2, Window: "hann"}.Validate())
+	assert.Error(t, Config{Width: 1024, Overlap: 3, Window: "hann"}.Validate())
+	assert.Error(t, Config{Width: 1024, Overlap: 2, Window: "unknown"}.Validate())
+}
+
+func TestProcessor_PreserveTransients(t *testing.T) {
+	const n = 8192
+	const attack = 3000
+	// 無音から急に立ち上がる減衰音
+	src := make([]float64, n)
+	for i := attack; i < n; i++ {
+		src[i] = math.Exp(-float64(i-attack)/200) * math.Sin(float64(i)*.9)
+	}
+	// accept は、オンセットを検出したときに加工を省くかどうかです（nil のときは検出しない）
+	preEcho := func(accept *bool) float64 {
+		input := buffer.NewWaveSource()
+		input.Append(src)
+		input.Close()
+		// 高域を除去すると、フレーム内で立ち上がりより前にも波形が広がる
+		p := NewProcessor(input, DefaultConfig, func(spec0 []complex128, wave0 []float64) []complex128 {
+			spec1 := make([]complex128, len(spec0))
+			copy(spec1[:len(spec0)/8], spec0)
+			return spec1
+		})
+		onsets := []int{}
+		if accept != nil {
+			p.PreserveTransients(1, func(i int, spec []complex128) bool {
+				onsets = append(onsets, i)
+				return *accept
+			})
+		}
+		p.Start()
+		result := []float64{}
+		for v := range p.Output() {
+			result = append(result, v)
+		}
+		if accept != nil {
+			assert.Equal(t, 1, len(onsets))
+			assert.True(t, onsets[0] <= attack && attack < onsets[0]+DefaultConfig.Step(), "onset=%d", onsets[0])
+		}
+		sum := .0
+		for _, v := range result[attack-DefaultConfig.Width : attack] {
+			sum += v * v
+		}
+		return sum
+	}
+	yes, no := true, false
+	assert.True(t, 1e-3 < preEcho(nil))
+	assert.True(t, preEcho(&yes) < 1e-12)
+	// 除外したオンセットは通常どおり加工する
+	assert.InDelta(t, preEcho(nil), preEcho(&no), 1e-12)
+}
@@ -5,99 +5,139 @@ import (
 	"math/cmplx"
 
 	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
 	"github.com/but80/voispire/internal/fft"
+	"github.com/but80/voispire/internal/onset"
 	"gonum.org/v1/gonum/fourier"
 )
 
-type cepstralShifter struct {
-	fft.Processor
+const (
+	// lifterTime0, lifterTime1 は、基本周波数が不明なときに包絡線成分とみなすケフレンシの上限 [sec] です。
+	// 繰り返しの初回は lifterTime0 、最後は lifterTime1 とし、その間は線形に補間します。
+	lifterTime0 = 192.0 / 44100.0
+	lifterTime1 = 96.0 / 44100.0
+	// lifterPeriod0, lifterPeriod1 は、基本周波数が既知のときに包絡線成分とみなすケフレンシの上限の、基本周期に対する比です。
+	// 初回から基本周期より短くすることで、倍音による細かな凹凸が包絡線に残らないようにします。
+	lifterPeriod0 = .5
+	lifterPeriod1 = .25
+	// minLifterOrder は、包絡線成分とみなす次数の下限です。
+	minLifterOrder = 8
+)
+
+// cepstralEnvelope は、ケプストラム分析により周波数スペクトルの包絡線を推定します。
+type cepstralEnvelope struct {
 	cfft       *fourier.FFT
 	width      int
 	fs         int
-	shiftInv   float64
-	maxPeakNum int
+	iterations int
+	smoother   *cepstrumSmoother
+	onset      *onset.Detector
 	envelope   []float64
 	envelopeDb []complex128
 	specDb     []complex128
 	ceps       []float64
-	spec1      []complex128
 }
 
-// NewCepstralShifter は、ケプストラム分析を用いたフォルマントシフタを作成します。
-func NewCepstralShifter(input *buffer.WaveSource, fs, width int, shift float64) FormantShifter {
-	s := &cepstralShifter{
+// newCepstralEnvelope は、新しい cepstralEnvelope を作成します。
+// step はフレームをずらす幅 [サンプル] で、時間方向の平滑化に使用します。
+func newCepstralEnvelope(fs, width, step int, o EnvelopeOptions) *cepstralEnvelope {
+	iterations := o.Iterations
+	if iterations < 1 {
+		iterations = DefaultIterations
+	}
+	e := &cepstralEnvelope{
 		cfft:       fourier.NewFFT(width),
 		width:      width,
 		fs:         fs,
+		iterations: iterations,
+		smoother:   newCepstrumSmoother(fs, width, step, o),
 		envelope:   make([]float64, width/2+1),
 		envelopeDb: make([]complex128, width/2+1),
 		specDb:     make([]complex128, width/2+1),
 		ceps:       make([]float64, width),
-		spec1:      make([]complex128, width/2+1),
 	}
-	analyzerStart(fs, width/2)
-	s.Processor = fft.NewProcessor(input, width, func(spec0 []complex128, wave0 []float64) []complex128 {
-		if len(spec0) <= 4 {
-			return spec0
-		}
-		if len(spec0) != len(s.specDb) {
-			panic("wrong length")
-		}
+	if e.smoother != nil {
+		e.onset = onset.New(onset.DefaultThreshold)
+	}
+	return e
+}
 
-		// 対数スペクトル
-		for i, v := range spec0 {
-			s.specDb[i] = complex(math.Log(cmplx.Abs(v)), 0)
-		}
+// lifterOrders は、最初と最後の繰り返しで包絡線成分とみなすケプストラムの次数を返します。
+// 基本周波数 f0 [Hz] が既知の場合は基本周期に合わせ、不明な場合（0 のとき）はサンプリング周波数に対して一定の時間とします。
+func (e *cepstralEnvelope) lifterOrders(f0 float64) (float64, float64) {
+	cn0 := lifterTime0 * float64(e.fs)
+	cn1 := lifterTime1 * float64(e.fs)
+	if 0 < f0 {
+		cn0 = lifterPeriod0 * float64(e.fs) / f0
+		cn1 = lifterPeriod1 * float64(e.fs) / f0
+	}
+	max := float64(e.width/2 - 1)
+	return clamp(cn0, minLifterOrder, max), clamp(cn1, minLifterOrder, max)
+}
+
+// estimate は、基本周波数が f0 [Hz]（不明なときは 0）である周波数スペクトル spec0 の包絡線を推定して返します。
+// 返されるスライスは次回の呼び出しで上書きされます。
+func (e *cepstralEnvelope) estimate(spec0 []complex128, wave0 []float64, f0 float64) []float64 {
+	if len(spec0) != len(e.specDb) {
+		panic("wrong length")
+	}
+
+	// 対数スペクトル
+	for i, v := range spec0 {
+		e.specDb[i] = complex(math.Log(cmplx.Abs(v)), 0)
+	}
 
-		// 包絡線（微細構造の中央を縫う）により隙間を埋めていく
-		const kn = 16   // 繰り返し回数
-		const cn0 = 192 // ケプストラム中の包絡線成分とみなす次数
-		const cn1 = 96
-		r := 1.0 / float64(s.width)
-		specSrc := s.specDb
-		for k := 1; k <= kn; k++ {
-			// ケプストラム
-			s.cfft.Sequence(s.ceps, specSrc)
+	// 包絡線（微細構造の中央を縫う）により隙間を埋めていく
+	kn := e.iterations             // 繰り返し回数
+	cn0, cn1 := e.lifterOrders(f0) // ケプストラム中の包絡線成分とみなす次数
+	r := 1.0 / float64(e.width)
+	specSrc := e.specDb
+	for k := 1; k <= kn; k++ {
+		// ケプストラム
+		e.cfft.Sequence(e.ceps, specSrc)
+
+		// 包絡線化
+		cn := int(cn1 + .5)
+		if 1 < kn {
+			cn = int(lerp(cn0, cn1, float64(k-1)/float64(kn-1)) + .5)
+		}
+		for i := cn; i < len(e.ceps)-cn; i++ {
+			e.ceps[i] = 0
+		}
 
-			// 包絡線化
-			cn := int(lerp(cn0, cn1, float64(k-1)/float64(kn-1)) + .5)
-			for i := cn; i < len(s.ceps)-cn; i++ {
-				s.ceps[i] = 0
+		// 最後の繰り返しで時間方向に平滑化する（音の立ち上がりではやり直す）
+		if k == kn && e.smoother != nil {
+			if e.onset.Detect(spec0) {
+				e.smoother.reset()
 			}
+			e.smoother.apply(e.ceps)
+		}
 
-			// 包絡線を周波数軸に戻し、元の周波数スペクトルの隙間を埋める
-			s.cfft.Coefficients(s.envelopeDb, s.ceps)
-			if k < kn {
-				for i, v := range s.envelopeDb {
-					v1 := real(v) * r
-					v0 := real(s.specDb[i])
-					if v1 < v0 {
-						v1 = v0
-					}
-					s.envelopeDb[i] = complex(v1, 0)
+		// 包絡線を周波数軸に戻し、元の周波数スペクトルの隙間を埋める
+		e.cfft.Coefficients(e.envelopeDb, e.ceps)
+		if k < kn {
+			for i, v := range e.envelopeDb {
+				v1 := real(v) * r
+				v0 := real(e.specDb[i])
+				if v1 < v0 {
+					v1 = v0
 				}
+				e.envelopeDb[i] = complex(v1, 0)
 			}
-			specSrc = s.envelopeDb
 		}
+		specSrc = e.envelopeDb
+	}
 
-		// 対数スペクトルから通常のスペクトルに戻す
-		for i, v := range s.envelopeDb {
-			v1 := real(v) * r
-			s.envelope[i] = math.Pow(math.E, v1)
-		}
+	// 対数スペクトルから通常のスペクトルに戻す
+	for i, v := range e.envelopeDb {
+		v1 := real(v) * r
+		e.envelope[i] = math.Pow(math.E, v1)
+	}
+	return e.envelope
+}
 
-		// flattenLowerCoefs(s.envelope, s.fs)
-		applyEnvelopeShift(s.spec1, spec0, s.envelope, shift)
-		analyzerFrame(&analyzerData{
-			fs:       fs,
-			fftWidth: width,
-			wave0:    wave0,
-			envelope: s.envelope,
-			spec0:    spec0,
-			spec1:    s.spec1,
-		})
-		return s.spec1
-	})
-	s.Processor.OnFinish(analyzerFinish)
-	return s
+// NewCepstralShifter は、ケプストラム分析を用いたフォルマントシフタを作成します。
+// シフト量 shift は変換中に変化してもよく、フレーム間で滑らかに補間されます。
+func NewCepstralShifter(input *buffer.WaveSource, fs int, config fft.Config, o EnvelopeOptions, shift control.Param) FormantShifter {
+	return newEnvelopeShifter(input, fs, config, o, newCepstralEnvelope(fs, config.Width, config.Step(), o), shift)
 }
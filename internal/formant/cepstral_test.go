@@ -0,0 +1,95 @@
+package formant
+
+import (
+	"math"
+	"testing"
+
+	"github.com/but80/voispire/internal/series"
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/fourier"
+)
+
+// harmonicSpectrum は、基本周波数 f0 の倍音からなる波形の周波数スペクトルを返します。
+func harmonicSpectrum(fs, width int, f0 float64) []complex128 {
+	wave := make([]float64, width)
+	for i := range wave {
+		for h := 1; float64(h)*f0 < float64(fs)/2; h++ {
+			wave[i] += math.Sin(2*math.Pi*f0*float64(h)*float64(i)/float64(fs)) / float64(h)
+		}
+	}
+	series.SqrtHann(width).Apply(wave, wave)
+	return fourier.NewFFT(width).Coefficients(nil, wave)
+}
+
+func TestCepstralEnvelope_lifterOrders(t *testing.T) {
+	e := newCepstralEnvelope(44100, 1024, 512, EnvelopeOptions{})
+	cn0, cn1 := e.lifterOrders(0)
+	assert.InDelta(t, 192, cn0, 1e-9)
+	assert.InDelta(t, 96, cn1, 1e-9)
+
+	// 基本周波数が高いほど次数は小さくなる
+	_, low := e.lifterOrders(100)
+	_, high := e.lifterOrders(400)
+	assert.True(t, high < low)
+
+	// サンプリング周波数が変わってもケフレンシは一定
+	e16 := newCepstralEnvelope(16000, 1024, 512, EnvelopeOptions{})
+	_, cn16 := e16.lifterOrders(200)
+	_, cn44 := e.lifterOrders(200)
+	assert.InDelta(t, cn16/16000, cn44/44100, 1e-9)
+}
+
+func TestCepstralEnvelope_estimate(t *testing.T) {
+	// 基本周波数が既知であれば、サンプリング周波数や話者の高さによらず、包絡線は倍音の間で大きく落ち込まない
+	for _, fs := range []int{16000, 44100, 48000} {
+		for _, f0 := range []float64{120, 300} {
+			width := 1024
+			e := newCepstralEnvelope(fs, width, width/2, EnvelopeOptions{})
+			env := e.estimate(harmonicSpectrum(fs, width, f0), nil, f0)
+			binHz := float64(fs) / float64(width)
+			for h := 2.0; h < 6; h++ {
+				peak := env[int(h*f0/binHz+.5)]
+				valley := env[int((h+.5)*f0/binHz+.5)]
+				assert.True(t, peak/valley < 1.8, "fs=%d f0=%.0f h=%.0f peak/valley=%.2f", fs, f0, h, peak/valley)
+			}
+		}
+	}
+}
+
+func TestCepstralEnvelope_smoothing(t *testing.T) {
+	const fs = 44100
+	const width = 1024
+	a := harmonicSpectrum(fs, width, 200)
+	b := harmonicSpectrum(fs, width, 230)
+	for _, method := range []string{SmoothingExp, SmoothingMedian} {
+		raw := newCepstralEnvelope(fs, width, width/2, EnvelopeOptions{})
+		smooth := newCepstralEnvelope(fs, width, width/2, EnvelopeOptions{Smoothing: method, SmoothingTau: .05})
+
+		// ときどき異なるフレームが混ざる場合、平滑化した包絡線の変化は小さくなる
+		const bin = 40
+		var rawDiff, smoothDiff, rawPrev, smoothPrev float64
+		for i := 0; i < 20; i++ {
+			spec := a
+			if i%4 == 3 {
+				spec = b
+			}
+			r := raw.estimate(spec, nil, 0)[bin]
+			s := smooth.estimate(spec, nil, 0)[bin]
+			if 10 <= i {
+				rawDiff += math.Abs(math.Log(r / rawPrev))
+				smoothDiff += math.Abs(math.Log(s / smoothPrev))
+			}
+			rawPrev, smoothPrev = r, s
+		}
+		assert.True(t, smoothDiff < rawDiff/2, "method=%s raw=%.3f smooth=%.3f", method, rawDiff, smoothDiff)
+
+		// 音の立ち上がりでは平滑化をやり直し、直ちに新しい包絡線に追従する
+		loud := make([]complex128, len(a))
+		for i, v := range a {
+			loud[i] = v * 10
+		}
+		want := raw.estimate(loud, nil, 0)[bin]
+		got := smooth.estimate(loud, nil, 0)[bin]
+		assert.InDelta(t, 1, got/want, 1e-6, "method=%s", method)
+	}
+}
@@ -0,0 +1,88 @@
+package formant
+
+import (
+	"math"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/fft"
+	"github.com/but80/voispire/internal/series"
+	"gonum.org/v1/gonum/fourier"
+)
+
+// Carrier は、チャンネルボコーダの搬送波です。
+type Carrier interface {
+	// Next は、入力の時刻 t [sec] における搬送波の次のサンプル値を返します。
+	Next(t float64) float64
+}
+
+// minCarrierEnvelope は、搬送波を平坦化するときに包絡線の値とみなす下限です。
+const minCarrierEnvelope = 1e-6
+
+// NewChannelVocoder は、入力（モジュレータ）の包絡線を搬送波 carrier にかけるチャンネルボコーダを作成します。
+// 搬送波はその包絡線で割って平坦化してから、 shift でフォルマントシフトした入力の包絡線をかけます。
+// 出力の各フレームのエネルギーは入力に合わせます。
+func NewChannelVocoder(input *buffer.WaveSource, fs int, config fft.Config, o EnvelopeOptions, carrier Carrier, shift control.Param) FormantShifter {
+	width := config.Width
+	step := config.Step()
+	modulator := newEnvelopeEstimator(fs, config, o)
+	carrierEnvelope := newEnvelopeEstimator(fs, config, EnvelopeOptions{Method: o.Method, Iterations: o.Iterations})
+	window, err := series.Named(config.Window, width)
+	if err != nil {
+		panic(err)
+	}
+	cfft := fourier.NewFFT(width)
+	carrierWave := make([]float64, width) // 搬送波の直近の1フレーム分
+	waveC := make([]float64, width)
+	specC := make([]complex128, width/2+1)
+	spec1 := make([]complex128, width/2+1)
+	smoother := control.NewSmoother(shiftTau, float64(step)/float64(fs))
+	tiltSmoother := control.NewSmoother(shiftTau, float64(step)/float64(fs))
+	frame := 0
+	filled := 0
+	return fft.NewProcessor(input, config, func(specM []complex128, waveM []float64) []complex128 {
+		t := float64(frame*step) / float64(fs)
+		frame++
+
+		// 搬送波をフレームの位置まで進める
+		if filled == width {
+			copy(carrierWave, carrierWave[step:])
+			filled -= step
+		}
+		for ; filled < width; filled++ {
+			carrierWave[filled] = carrier.Next(t + float64(filled)/float64(fs))
+		}
+		if len(specM) <= 4 {
+			return specM
+		}
+		window.Apply(waveC, carrierWave)
+		cfft.Coefficients(specC, waveC)
+		series.CmplxDivFloatConst(specC, specC, float64(width))
+
+		f0 := o.f0At(t + float64(width/2)/float64(fs))
+		envM := modulator.estimate(specM, waveM, f0)
+		o.flattenLow(envM, fs, f0)
+		envC := carrierEnvelope.estimate(specC, waveC, 0)
+
+		n := len(spec1)
+		warp := o.warp()
+		s := smoother.Next(shift.At(t))
+		tilt := tiltSmoother.Next(o.tiltAt(t))
+		energyM := .0
+		energy1 := .0
+		spec1[0] = 0
+		for i := 1; i < n; i++ {
+			e := envelopeAt(envM, sourceBin(warp, i, n, fs, s)) * tiltGain(i, n, fs, tilt)
+			spec1[i] = specC[i] * complex(e/math.Max(envC[i], minCarrierEnvelope), 0)
+			energyM += real(specM[i])*real(specM[i]) + imag(specM[i])*imag(specM[i])
+			energy1 += real(spec1[i])*real(spec1[i]) + imag(spec1[i])*imag(spec1[i])
+		}
+		if 0 < energy1 {
+			g := complex(math.Sqrt(energyM/energy1), 0)
+			for i := range spec1 {
+				spec1[i] *= g
+			}
+		}
+		return spec1
+	})
+}
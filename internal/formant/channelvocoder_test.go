@@ -0,0 +1,65 @@
+package formant
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/fft"
+	"github.com/but80/voispire/internal/series"
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/fourier"
+)
+
+// harmonicCarrier は、基本周波数 f0 の等振幅の倍音列です。
+type harmonicCarrier struct {
+	f0 float64
+	fs float64
+	i  int
+}
+
+func (c *harmonicCarrier) Next(t float64) float64 {
+	v := .0
+	for f := c.f0; f < c.fs/2; f += c.f0 {
+		v += math.Sin(2 * math.Pi * f * float64(c.i) / c.fs)
+	}
+	c.i++
+	return v
+}
+
+func TestChannelVocoder(t *testing.T) {
+	fs := 16000
+	src := make([]float64, fs)
+	for i := range src {
+		for f := 200.0; f < 4000; f += 200 {
+			a := math.Exp(-math.Pow((f-800)/300, 2)) // 800Hz にフォルマント
+			src[i] += a * math.Sin(2*math.Pi*f*float64(i)/float64(fs))
+		}
+	}
+	input := buffer.NewWaveSource()
+	input.Append(src)
+	input.Close()
+	carrier := &harmonicCarrier{f0: 130, fs: float64(fs)}
+	p := NewChannelVocoder(input, fs, fft.DefaultConfig, EnvelopeOptions{}, carrier, control.Const(1))
+	p.Start()
+	result := []float64{}
+	for v := range p.Output() {
+		result = append(result, v)
+	}
+
+	// 出力は搬送波の倍音からなり、入力のフォルマントに最も近い倍音が最大となる
+	width := 4096
+	wave := make([]float64, width)
+	series.Hann(width).Apply(wave, result[fs/2-width/2:fs/2+width/2])
+	spec := fourier.NewFFT(width).Coefficients(nil, wave)
+	peak := 1
+	for i := range spec {
+		if cmplx.Abs(spec[peak]) < cmplx.Abs(spec[i]) {
+			peak = i
+		}
+	}
+	freq := float64(peak) * float64(fs) / float64(width)
+	assert.InDelta(t, 780, freq, 10)
+}
@@ -1,6 +1,9 @@
 package formant
 
 import (
+	"math"
+
+	"github.com/but80/voispire/internal/control"
 	"github.com/but80/voispire/internal/fft"
 	"golang.org/x/xerrors"
 )
@@ -10,6 +13,99 @@ type FormantShifter interface {
 	fft.Processor
 }
 
+// DefaultIterations は、包絡線の推定を繰り返す既定の回数です。
+const DefaultIterations = 16
+
+// EnvelopeOptions は、周波数スペクトルの包絡線の推定に関するオプションです。
+type EnvelopeOptions struct {
+	// Method は、包絡線の推定方法（ EnvelopeCepstrum または EnvelopeLPC ）です。空のときは EnvelopeCepstrum とします。
+	Method string
+	// Iterations は、包絡線の推定を繰り返す回数です。0 のときは DefaultIterations とします。
+	Iterations int
+	// F0 は、入力の時刻 t [sec] における基本周波数 [Hz] です（不明なときは 0）。
+	// 既知の場合、包絡線成分とみなすケプストラムの次数を基本周期に合わせます。nil のときは常に不明とみなします。
+	F0 control.Param
+	// LowCutoff は、包絡線を平坦化する低域の上限 [Hz] です。0 のときは平坦化しません。
+	LowCutoff float64
+	// LowCutoffF0 が true の場合、基本周波数が既知のフレームでは LowCutoff の代わりに基本周波数未満を平坦化します。
+	// 基本周波数が不明なフレームでは、 LowCutoff（0 のときは最低の基本周波数）から包絡線の最初の極大までを平坦化します。
+	LowCutoffF0 bool
+	// LPCOrder は、線形予測分析の次数です。0 のときはサンプリング周波数から決めます。
+	LPCOrder int
+	// Warp は、フォルマントシフトにおける周波数軸の伸縮方法です。nil のときは LinearWarp とします。
+	Warp Warp
+	// Smoothing は、ケプストラム分析で推定した包絡線の時間方向の平滑化の方法
+	// （ SmoothingNone, SmoothingExp, SmoothingMedian ）です。空のときは平滑化しません。
+	Smoothing string
+	// SmoothingTau は、平滑化の時定数 [sec] です。
+	SmoothingTau float64
+	// Mapping は、フォルマントシフト後に包絡線へかける補正です。nil のときは補正しません。
+	Mapping *EnvelopeMapping
+	// Tilt は、入力の時刻 t [sec] において、かけ直す包絡線に加えるスペクトルの傾き [dB/oct] です。
+	// 正の値で明るい声に、負の値で暗い声になります。nil のときは傾けません。
+	Tilt control.Param
+	// InputScale は、入力の時刻 t [sec] における、元の音声からフォルマントシフタの入力までの周波数の比率
+	// （前段のストレッチャによるピッチシフトの比率）です。nil のときは 1 とします。
+	InputScale control.Param
+	// OutputScale は、入力の時刻 t [sec] における、フォルマントシフタの出力から最終的な出力までの周波数の比率
+	// （後段のストレッチャによるピッチシフトの比率）です。nil のときは 1 とします。
+	// NewShifter は、これらの比率によるフォルマントのずれを線形に打ち消した上で、
+	// 元の音声と最終的な出力の周波数の間をシフト量に応じて Warp で伸縮します。
+	OutputScale control.Param
+}
+
+func (o EnvelopeOptions) warp() Warp {
+	if o.Warp == nil {
+		return LinearWarp{}
+	}
+	return o.Warp
+}
+
+// flattenLow は、オプションの指定に従って包絡線 env の低域を平坦化します。
+// f0 は基本周波数 [Hz]（不明なときは 0）です。
+func (o EnvelopeOptions) flattenLow(env []float64, fs int, f0 float64) {
+	switch {
+	case o.LowCutoffF0 && 0 < f0:
+		flattenLowerCoefs(env, fs, f0, false)
+	case o.LowCutoffF0:
+		cutoff := o.LowCutoff
+		if cutoff <= 0 {
+			cutoff = f0Floor
+		}
+		flattenLowerCoefs(env, fs, cutoff, true)
+	case 0 < o.LowCutoff:
+		flattenLowerCoefs(env, fs, o.LowCutoff, false)
+	}
+}
+
+func (o EnvelopeOptions) tiltAt(t float64) float64 {
+	if o.Tilt == nil {
+		return 0
+	}
+	return o.Tilt.At(t)
+}
+
+func (o EnvelopeOptions) inputScaleAt(t float64) float64 {
+	if o.InputScale == nil {
+		return 1
+	}
+	return o.InputScale.At(t)
+}
+
+func (o EnvelopeOptions) outputScaleAt(t float64) float64 {
+	if o.OutputScale == nil {
+		return 1
+	}
+	return o.OutputScale.At(t)
+}
+
+func (o EnvelopeOptions) f0At(t float64) float64 {
+	if o.F0 == nil {
+		return 0
+	}
+	return o.F0.At(t)
+}
+
 type analyzerData struct {
 	fs       int
 	fftWidth int
@@ -21,15 +117,26 @@ type analyzerData struct {
 
 const f0Floor = 70
 
-func flattenLowerCoefs(env []float64, fs int) {
+const (
+	// tiltPivot は、スペクトルの傾きを変えても振幅が変わらない周波数 [Hz] です。
+	tiltPivot = 1000.0
+	// maxTiltGain は、スペクトルの傾きによるゲインの絶対値の上限 [dB] です。
+	maxTiltGain = 24.0
+)
+
+// flattenLowerCoefs は、包絡線 env の周波数 cutoff [Hz] 未満の部分を平坦化します。
+// 基本周波数より低い帯域には倍音が無く、包絡線で割って戻す処理によって低域の雑音が強調されることがあるため、
+// この帯域の包絡線を一定とし、フォルマントシフトの影響を受けないようにします。
+// peak が true の場合は、 cutoff から包絡線の最初の極大まで平坦化する範囲を広げます。
+func flattenLowerCoefs(env []float64, fs int, cutoff float64, peak bool) {
 	n := len(env)
 	fn := float64(fs) / 2
-	i0 := int(float64(n) * f0Floor / fn)
-	if i0 == 0 {
+	i0 := int(float64(n-1)*cutoff/fn + .5)
+	if i0 <= 0 {
 		return
 	}
 	// 1st max
-	for ; i0 < n; i0++ {
+	for ; peak && i0 < n; i0++ {
 		if env[i0] < env[i0-1] {
 			break
 		}
@@ -59,24 +166,52 @@ func lerp(a, b, t float64) float64 {
 	return a*(1-t) + b*t
 }
 
-func applyEnvelopeShift(spec1, spec0 []complex128, env []float64, shift float64) {
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
+
+// sourceBin は、伸縮方法 warp・シフト量 shift のときに、長さ n の包絡線の位置 i [bin] へ移す元の位置 [bin] を返します。
+func sourceBin(warp Warp, i, n, fs int, shift float64) float64 {
+	nyquist := float64(fs) / 2
+	binHz := nyquist / float64(n-1)
+	return warp.Source(float64(i)*binHz, nyquist, shift) / binHz
+}
+
+// tiltGain は、長さ n の包絡線の位置 i [bin] に、傾き tilt [dB/oct] のときにかける倍率を返します。
+func tiltGain(i, n, fs int, tilt float64) float64 {
+	if tilt == 0 {
+		return 1
+	}
+	hz := float64(i) * float64(fs) / 2 / float64(n-1)
+	db := clamp(tilt*math.Log2(hz/tiltPivot), -maxTiltGain, maxTiltGain)
+	return math.Pow(10, db/20)
+}
+
+// applyEnvelopeShift は、包絡線 env を係数 shift で伸縮し、傾き tilt [dB/oct] を加えて spec0 にかけ直した結果を spec1 に格納します。
+func applyEnvelopeShift(spec1, spec0 []complex128, env []float64, warp Warp, fs int, shift, tilt float64) {
 	n := len(spec0)
 	if n != len(env) {
 		panic(xerrors.Errorf("Envelope size mismatch (%d != %d)", n, len(env)))
 	}
 	spec1[0] = spec0[0]
 	for i := 1; i < n; i++ {
-		j := float64(i) / shift
-		if j < 1 {
-			j = 1
-		}
-		ji := int(j)
-		jf := j - float64(ji)
-		if n-2 < ji {
-			ji = n - 2
-			jf = 1
-		}
-		e := lerp(env[ji], env[ji+1], jf)
+		e := envelopeAt(env, sourceBin(warp, i, n, fs, shift)) * tiltGain(i, n, fs, tilt)
 		spec1[i] = spec0[i] * complex(e/env[i], .0)
 	}
 }
+
+// envelopeAt は、包絡線 env の位置 j [bin] における値を線形補間して返します。
+// 直流成分は参照せず、範囲外は端の値とします。
+func envelopeAt(env []float64, j float64) float64 {
+	n := len(env)
+	if j < 1 {
+		j = 1
+	}
+	ji := int(j)
+	jf := j - float64(ji)
+	if n-2 < ji {
+		ji = n - 2
+		jf = 1
+	}
+	return lerp(env[ji], env[ji+1], jf)
+}
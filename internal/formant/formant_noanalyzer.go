@@ -2,6 +2,9 @@
 
 package formant
 
+func analyzerStart(fs, fftStep int) {
+}
+
 func analyzerFrame(data *analyzerData) {
 }
 
@@ -0,0 +1,80 @@
+package formant
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/but80/voispire/internal/series"
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/fourier"
+)
+
+// vowelSpectrum は、第1フォルマントを 600Hz 付近に持つ基本周波数 f0 の合成母音に、30Hz の低域の雑音を加えた波形の周波数スペクトルを返します。
+func vowelSpectrum(fs, width int, f0 float64) []complex128 {
+	wave := make([]float64, width)
+	for i := range wave {
+		for h := 1; float64(h)*f0 < float64(fs)/2; h++ {
+			f := float64(h) * f0
+			a := 1 / (1 + math.Pow((f-600)/150, 2))
+			wave[i] += a * math.Sin(2*math.Pi*f*float64(i)/float64(fs))
+		}
+		wave[i] += .01 * math.Sin(2*math.Pi*30*float64(i)/float64(fs))
+	}
+	series.SqrtHann(width).Apply(wave, wave)
+	return fourier.NewFFT(width).Coefficients(nil, wave)
+}
+
+// bassGain は、係数 shift でフォルマントシフトしたときの、基本周波数 f0 未満の帯域の最大ゲイン [dB] を返します。
+func bassGain(t *testing.T, o EnvelopeOptions, f0, shift float64) float64 {
+	const fs = 44100
+	const width = 1024
+	spec0 := vowelSpectrum(fs, width, f0)
+	env := newCepstralEnvelope(fs, width, width/2, o).estimate(spec0, nil, 0)
+	o.flattenLow(env, fs, f0)
+	spec1 := make([]complex128, len(spec0))
+	applyEnvelopeShift(spec1, spec0, env, LinearWarp{}, fs, shift, 0)
+
+	gain := math.Inf(-1)
+	for i := 1; float64(i)*fs/width < f0*.75; i++ {
+		gain = math.Max(gain, 20*math.Log10(cmplx.Abs(spec1[i])/cmplx.Abs(spec0[i])))
+	}
+	t.Logf("bass gain: %.1f dB (cutoff=%.0f, f0 based=%v)", gain, o.LowCutoff, o.LowCutoffF0)
+	return gain
+}
+
+func TestFlattenLowerCoefs_bassResponse(t *testing.T) {
+	// ピッチを上げるとき、フォルマントシフタには1未満の係数が与えられる
+	const f0 = 220
+	shift := math.Pow(2, -5.0/12.0)
+
+	// 平坦化しない場合、基本周波数未満の雑音が強調される
+	without := bassGain(t, EnvelopeOptions{}, f0, shift)
+	assert.True(t, 3 < without)
+
+	// 平坦化すると、基本周波数未満の帯域はそのまま
+	fixed := bassGain(t, EnvelopeOptions{LowCutoff: 200}, f0, shift)
+	assert.InDelta(t, 0, fixed, .1)
+	byF0 := bassGain(t, EnvelopeOptions{LowCutoffF0: true}, f0, shift)
+	assert.InDelta(t, 0, byF0, .1)
+}
+
+func TestApplyEnvelopeShift_tilt(t *testing.T) {
+	const fs = 44100
+	const width = 1024
+	spec0 := vowelSpectrum(fs, width, 220)
+	env := newCepstralEnvelope(fs, width, width/2, EnvelopeOptions{}).estimate(spec0, nil, 0)
+	spec1 := make([]complex128, len(spec0))
+	applyEnvelopeShift(spec1, spec0, env, LinearWarp{}, fs, 1, 6)
+
+	// 1kHz を中心に、1オクターブあたり 6dB 傾く
+	gainAt := func(hz float64) float64 {
+		i := int(hz*width/fs + .5)
+		return 20 * math.Log10(cmplx.Abs(spec1[i])/cmplx.Abs(spec0[i]))
+	}
+	assert.InDelta(t, 0, gainAt(1000), .5)
+	assert.InDelta(t, 12, gainAt(4000), .5)
+	assert.InDelta(t, -12, gainAt(250), .5)
+	// 極端な帯域ではゲインを制限する
+	assert.InDelta(t, maxTiltGain, 20*math.Log10(tiltGain(len(spec0)-1, len(spec0), fs, 12)), 1e-9)
+}
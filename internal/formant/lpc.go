@@ -0,0 +1,174 @@
+package formant
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/fft"
+	"gonum.org/v1/gonum/fourier"
+)
+
+const (
+	// minFormantFreq は、フォルマントとみなす最低の周波数 [Hz] です。
+	minFormantFreq = 90.0
+	// maxFormants は、推定するフォルマントの最大数です。
+	maxFormants = 5
+)
+
+// FormantTracker は、推定したフォルマント周波数を提供します。
+type FormantTracker interface {
+	// Formants は、直近のフレームで推定したフォルマント周波数 [Hz] を低い順に返します。
+	Formants() []float64
+}
+
+// burg は、Burg法により波形 x の線形予測係数を求めて a[0..order] に格納し、予測誤差の平均電力を返します。
+// a[0] は常に 1 となります。
+func burg(x []float64, order int, a []float64) float64 {
+	n := len(x)
+	f := append([]float64{}, x...)
+	b := append([]float64{}, x...)
+	tmp := make([]float64, order+1)
+	for i := range a[:order+1] {
+		a[i] = 0
+	}
+	a[0] = 1
+	e := .0
+	for _, v := range x {
+		e += v * v
+	}
+	e /= float64(n)
+	for m := 1; m <= order && m < n; m++ {
+		num, den := .0, .0
+		for i := m; i < n; i++ {
+			num += f[i] * b[i-1]
+			den += f[i]*f[i] + b[i-1]*b[i-1]
+		}
+		if den == 0 {
+			break
+		}
+		k := -2 * num / den
+
+		// 係数を更新
+		copy(tmp, a[:m+1])
+		for i := 1; i <= m; i++ {
+			a[i] = tmp[i] + k*tmp[m-i]
+		}
+
+		// 前向き・後ろ向きの予測誤差を更新
+		for i := n - 1; m <= i; i-- {
+			fi := f[i]
+			f[i] = fi + k*b[i-1]
+			b[i] = b[i-1] + k*fi
+		}
+		e *= 1 - k*k
+	}
+	return e
+}
+
+// lpcFormants は、線形予測による包絡線 env のピークからフォルマント周波数 [Hz] を求めます。
+func lpcFormants(env []float64, fs int) []float64 {
+	n := len(env)
+	binHz := float64(fs) / float64(2*(n-1))
+	result := []float64{}
+	for i := 1; i < n-1 && len(result) < maxFormants; i++ {
+		if !(env[i-1] < env[i] && env[i+1] <= env[i]) {
+			continue
+		}
+		// 対数振幅の放物線補間でピークの位置を求める
+		y0, y1, y2 := math.Log(env[i-1]), math.Log(env[i]), math.Log(env[i+1])
+		d := .0
+		if den := y0 - 2*y1 + y2; den != 0 {
+			d = .5 * (y0 - y2) / den
+		}
+		freq := (float64(i) + d) * binHz
+		if freq < minFormantFreq {
+			continue
+		}
+		result = append(result, freq)
+	}
+	return result
+}
+
+// lpcEnvelope は、線形予測分析により周波数スペクトルの包絡線を推定します。
+type lpcEnvelope struct {
+	fft      *fourier.FFT
+	fs       int
+	width    int
+	order    int
+	coefs    []float64
+	padded   []float64
+	spec     []complex128
+	envelope []float64
+	formants []float64
+	mutex    sync.Mutex
+}
+
+func newLPCEnvelope(fs, width int, o EnvelopeOptions) *lpcEnvelope {
+	order := o.LPCOrder
+	if order < 1 {
+		// 経験則による次数（サンプリング周波数 1kHz あたり1次、および声門と放射の特性の分）
+		order = 2 + fs/1000
+	}
+	return &lpcEnvelope{
+		fft:      fourier.NewFFT(width),
+		fs:       fs,
+		width:    width,
+		order:    order,
+		coefs:    make([]float64, order+1),
+		padded:   make([]float64, width),
+		spec:     make([]complex128, width/2+1),
+		envelope: make([]float64, width/2+1),
+	}
+}
+
+func (e *lpcEnvelope) estimate(spec0 []complex128, wave0 []float64, f0 float64) []float64 {
+	power := burg(wave0, e.order, e.coefs)
+	if power <= 0 {
+		for i := range e.envelope {
+			e.envelope[i] = 1
+		}
+		return e.envelope
+	}
+
+	// 全極モデルの振幅特性 sqrt(power) / |A(e^jω)| を求める
+	// spec0 はFFTのサイズで割られているため、同じ尺度となるよう調整する
+	copy(e.padded, e.coefs)
+	for i := len(e.coefs); i < len(e.padded); i++ {
+		e.padded[i] = 0
+	}
+	e.fft.Coefficients(e.spec, e.padded)
+	g := math.Sqrt(power / float64(e.width))
+	for i, v := range e.spec {
+		e.envelope[i] = g / math.Max(cmplx.Abs(v), 1e-12)
+	}
+
+	formants := lpcFormants(e.envelope, e.fs)
+	e.mutex.Lock()
+	e.formants = formants
+	e.mutex.Unlock()
+	return e.envelope
+}
+
+func (e *lpcEnvelope) Formants() []float64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]float64{}, e.formants...)
+}
+
+type lpcShifter struct {
+	*envelopeShifter
+	*lpcEnvelope
+}
+
+// NewLPCShifter は、線形予測分析（Burg法）を用いたフォルマントシフタを作成します。
+// ケプストラム分析を繰り返す方法より処理が軽く、推定したフォルマント周波数を FormantTracker として提供します。
+func NewLPCShifter(input *buffer.WaveSource, fs int, config fft.Config, o EnvelopeOptions, shift control.Param) FormantShifter {
+	env := newLPCEnvelope(fs, config.Width, o)
+	return &lpcShifter{
+		envelopeShifter: newEnvelopeShifter(input, fs, config, o, env, shift),
+		lpcEnvelope:     env,
+	}
+}
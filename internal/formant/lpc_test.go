@@ -0,0 +1,76 @@
+package formant
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/but80/voispire/internal/series"
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/fourier"
+)
+
+// resonator は、中心周波数 freq [Hz]・帯域幅 bw [Hz] の2次の共振フィルタの係数を返します。
+func resonator(freq, bw float64, fs int) (float64, float64) {
+	r := math.Exp(-math.Pi * bw / float64(fs))
+	return 2 * r * math.Cos(2*math.Pi*freq/float64(fs)), -r * r
+}
+
+func TestBurg(t *testing.T) {
+	// 既知のAR(2)過程の係数を推定できる
+	rnd := rand.New(rand.NewSource(1))
+	a1, a2 := resonator(1000, 100, 16000)
+	x := make([]float64, 4096)
+	for i := range x {
+		x[i] = rnd.NormFloat64()
+		if 1 <= i {
+			x[i] += a1 * x[i-1]
+		}
+		if 2 <= i {
+			x[i] += a2 * x[i-2]
+		}
+	}
+	a := make([]float64, 3)
+	power := burg(x, 2, a)
+	assert.Equal(t, 1.0, a[0])
+	assert.InDelta(t, -a1, a[1], .02)
+	assert.InDelta(t, -a2, a[2], .02)
+	assert.InDelta(t, 1.0, power, .1)
+}
+
+func TestLPCEnvelope_Formants(t *testing.T) {
+	// パルス列を2つの共振フィルタに通した合成母音のフォルマントを推定できる
+	const fs = 16000
+	const width = 1024
+	formants := []float64{700, 1200}
+	x := make([]float64, width)
+	for i := range x {
+		if i%128 == 0 {
+			x[i] = 1
+		}
+	}
+	for _, f := range formants {
+		a1, a2 := resonator(f, 80, fs)
+		y := make([]float64, len(x))
+		for i := range x {
+			y[i] = x[i]
+			if 1 <= i {
+				y[i] += a1 * y[i-1]
+			}
+			if 2 <= i {
+				y[i] += a2 * y[i-2]
+			}
+		}
+		x = y
+	}
+	series.Hann(width).Apply(x, x)
+	spec := fourier.NewFFT(width).Coefficients(nil, x)
+
+	e := newLPCEnvelope(fs, width, EnvelopeOptions{LPCOrder: 12})
+	e.estimate(spec, x, 0)
+	result := e.Formants()
+	if assert.True(t, 2 <= len(result)) {
+		assert.InDelta(t, formants[0], result[0], 50)
+		assert.InDelta(t, formants[1], result[1], 50)
+	}
+}
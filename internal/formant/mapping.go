@@ -0,0 +1,126 @@
+package formant
+
+import (
+	"math"
+
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/fft"
+	"github.com/but80/voispire/internal/series"
+	"gonum.org/v1/gonum/fourier"
+)
+
+// maxMappingGain は、 EnvelopeMapping が周波数ごとにかけるゲインの絶対値の上限（自然対数）です。
+// 平均包絡線の差が極端な帯域で、雑音が過度に強調されないようにします（約 24dB）。
+const maxMappingGain = 2.77
+
+// LogEnvelopes は、波形 wave をフレームごとに分析し、包絡線の対数振幅（自然対数）の系列を返します。
+// i 番目の要素は wave の i*config.Step() サンプル目から始まるフレームの、周波数 [bin] ごとの値（長さ config.Width/2+1）です。
+// o.F0 が指定されている場合、各フレームの中心における基本周波数を包絡線の推定に使用します。
+func LogEnvelopes(wave []float64, fs int, config fft.Config, o EnvelopeOptions) [][]float64 {
+	// フレームごとに独立して扱うため、時間方向の平滑化は行わない
+	o.Smoothing = SmoothingNone
+	width := config.Width
+	step := config.Step()
+	envelope := newEnvelopeEstimator(fs, config, o)
+	window, err := series.Named(config.Window, width)
+	if err != nil {
+		panic(err)
+	}
+	f := fourier.NewFFT(width)
+	wave0 := make([]float64, width)
+	spec0 := make([]complex128, width/2+1)
+	result := [][]float64{}
+	for i := 0; i+width <= len(wave); i += step {
+		f0 := o.f0At(float64(i+width/2) / float64(fs))
+		window.Apply(wave0, wave[i:i+width])
+		f.Coefficients(spec0, wave0)
+		series.CmplxDivFloatConst(spec0, spec0, float64(width))
+		env := envelope.estimate(spec0, wave0, f0)
+		o.flattenLow(env, fs, f0)
+		logEnv := make([]float64, len(env))
+		for j, e := range env {
+			logEnv[j] = math.Log(math.Max(e, 1e-12))
+		}
+		result = append(result, logEnv)
+	}
+	return result
+}
+
+// AverageEnvelope は、波形 wave の有声フレームにおける包絡線の対数振幅（自然対数）の平均を返します。
+// 返されるスライスは周波数 [bin] ごとの値で、長さは config.Width/2+1 です。
+// o.F0 がフレームの中心で 0 を返すフレームは無声とみなして除外します。有声フレームがない場合は nil を返します。
+func AverageEnvelope(wave []float64, fs int, config fft.Config, o EnvelopeOptions) []float64 {
+	sum := make([]float64, config.Width/2+1)
+	frames := 0
+	for i, env := range LogEnvelopes(wave, fs, config, o) {
+		t := float64(i*config.Step()+config.Width/2) / float64(fs)
+		if o.F0 != nil && o.F0.At(t) <= 0 {
+			continue
+		}
+		for j, e := range env {
+			sum[j] += e
+		}
+		frames++
+	}
+	if frames == 0 {
+		return nil
+	}
+	for j := range sum {
+		sum[j] /= float64(frames)
+	}
+	return sum
+}
+
+// EnvelopeMapping は、フォルマントシフト後のスペクトルに周波数ごとのゲインをかけ、
+// 包絡線を別の話者のものに近づけます。
+type EnvelopeMapping struct {
+	// LogGain は、最終的な出力における周波数 [bin] ごとのゲイン（自然対数）です。
+	LogGain []float64
+	// Frames は、時刻によって変化するゲインで、 FramePeriod [sec] ごとの LogGain の系列です。
+	// nil でない場合は LogGain の代わりに使用します。
+	Frames      [][]float64
+	FramePeriod float64
+	// Scale は、時刻 t [sec] における、フォルマントシフタの出力から最終的な出力までの周波数の比率
+	// （後段のストレッチャによるピッチシフトの比率）です。nil のときは 1 とします。
+	Scale control.Param
+}
+
+// NewEnvelopeMapping は、サンプリング周波数 fsFrom で分析した平均包絡線 from を、
+// サンプリング周波数 fsTo で分析した平均包絡線 to に近づける EnvelopeMapping を作成します。
+// from, to は同じフレーム幅で AverageEnvelope が返したもので、 LogGain の周波数軸は from に合わせます。
+// 録音レベルの違いが音量に影響しないよう、ゲインの平均は 0 とします。
+func NewEnvelopeMapping(from []float64, fsFrom int, to []float64, fsTo int) *EnvelopeMapping {
+	n := len(from)
+	gain := make([]float64, n)
+	mean := .0
+	for i := range gain {
+		j := float64(i) * float64(fsFrom) / float64(fsTo)
+		gain[i] = envelopeAt(to, j) - from[i]
+		mean += gain[i]
+	}
+	mean /= float64(n)
+	for i := range gain {
+		gain[i] = clamp(gain[i]-mean, -maxMappingGain, maxMappingGain)
+	}
+	return &EnvelopeMapping{LogGain: gain}
+}
+
+// apply は、時刻 t [sec] のフレームのスペクトル spec にゲインをかけます。
+func (m *EnvelopeMapping) apply(spec []complex128, t float64) {
+	gain := m.LogGain
+	if m.Frames != nil {
+		i := int(t/m.FramePeriod + .5)
+		if len(m.Frames) <= i {
+			i = len(m.Frames) - 1
+		}
+		gain = m.Frames[i]
+	}
+	scale := 1.0
+	if m.Scale != nil {
+		scale = m.Scale.At(t)
+	}
+	for i := 1; i < len(spec); i++ {
+		g := envelopeAt(gain, float64(i)*scale)
+		spec[i] *= complex(math.Exp(g), 0)
+	}
+}
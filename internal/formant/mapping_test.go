@@ -0,0 +1,43 @@
+package formant
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEnvelopeMapping(t *testing.T) {
+	n := 513
+	flat := make([]float64, n)
+	tilt := make([]float64, n)
+	for i := range tilt {
+		tilt[i] = -float64(i) / float64(n-1) // 0..-1
+	}
+
+	m := NewEnvelopeMapping(flat, 16000, flat, 16000)
+	for _, g := range m.LogGain {
+		assert.InDelta(t, 0, g, 1e-9)
+	}
+
+	// 音量の差は取り除かれ、形の差のみが残る
+	m = NewEnvelopeMapping(flat, 16000, tilt, 16000)
+	assert.InDelta(t, .5, m.LogGain[0], 1e-2)
+	assert.InDelta(t, -.5, m.LogGain[n-1], 1e-2)
+
+	// 目標のサンプリング周波数が 2 倍の場合、目標の前半が入力の全体に対応する
+	m = NewEnvelopeMapping(flat, 16000, tilt, 32000)
+	assert.InDelta(t, -.5, m.LogGain[n-1]-m.LogGain[1], 1e-2)
+
+	// ゲインは上限で制限される
+	m = NewEnvelopeMapping(flat, 16000, []float64{0, 0, 100}, 16000)
+	assert.True(t, m.LogGain[n-1] <= maxMappingGain)
+
+	spec := make([]complex128, n)
+	for i := range spec {
+		spec[i] = 1
+	}
+	m = NewEnvelopeMapping(flat, 16000, tilt, 16000)
+	m.apply(spec, 0)
+	assert.InDelta(t, math.Exp(m.LogGain[n/2]), real(spec[n/2]), 1e-9)
+}
@@ -0,0 +1,89 @@
+package formant
+
+import (
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/fft"
+)
+
+// 包絡線の推定方法
+const (
+	EnvelopeCepstrum = "cepstrum"
+	EnvelopeLPC      = "lpc"
+)
+
+// envelopeEstimator は、周波数スペクトルの包絡線を推定します。
+type envelopeEstimator interface {
+	// estimate は、窓がけした波形 wave0 とその周波数スペクトル spec0 から包絡線を推定して返します。
+	// f0 は基本周波数 [Hz]（不明なときは 0）です。返されるスライスは次回の呼び出しで上書きされます。
+	estimate(spec0 []complex128, wave0 []float64, f0 float64) []float64
+}
+
+// newEnvelopeEstimator は、 o.Method で指定された方法で包絡線を推定する envelopeEstimator を作成します。
+func newEnvelopeEstimator(fs int, config fft.Config, o EnvelopeOptions) envelopeEstimator {
+	if o.Method == EnvelopeLPC {
+		return newLPCEnvelope(fs, config.Width, o)
+	}
+	return newCepstralEnvelope(fs, config.Width, config.Step(), o)
+}
+
+type envelopeShifter struct {
+	fft.Processor
+	spec1 []complex128
+}
+
+// shiftTau は、シフト量の変更に追従する時定数 [sec] です。
+const shiftTau = .03
+
+// newEnvelopeShifter は、 envelope で推定した包絡線を周波数軸上で伸縮するフォルマントシフタを作成します。
+func newEnvelopeShifter(input *buffer.WaveSource, fs int, config fft.Config, o EnvelopeOptions, envelope envelopeEstimator, shift control.Param) *envelopeShifter {
+	width := config.Width
+	s := &envelopeShifter{
+		spec1: make([]complex128, width/2+1),
+	}
+	analyzerStart(fs, config.Step())
+	step := float64(config.Step()) / float64(fs)
+	smoother := control.NewSmoother(shiftTau, step)
+	tiltSmoother := control.NewSmoother(shiftTau, step)
+	inSmoother := control.NewSmoother(shiftTau, step)
+	outSmoother := control.NewSmoother(shiftTau, step)
+	frame := 0
+	s.Processor = fft.NewProcessor(input, config, func(spec0 []complex128, wave0 []float64) []complex128 {
+		t := float64(frame) * step
+		frame++
+		if len(spec0) <= 4 {
+			return spec0
+		}
+		f0 := o.f0At(t + float64(width/2)/float64(fs))
+		env := envelope.estimate(spec0, wave0, f0)
+		o.flattenLow(env, fs, f0)
+		warp := scaledWarp{
+			Warp: o.warp(),
+			in:   inSmoother.Next(o.inputScaleAt(t)),
+			out:  outSmoother.Next(o.outputScaleAt(t)),
+		}
+		applyEnvelopeShift(s.spec1, spec0, env, warp, fs, smoother.Next(shift.At(t)), tiltSmoother.Next(o.tiltAt(t)))
+		if o.Mapping != nil {
+			o.Mapping.apply(s.spec1, t)
+		}
+		analyzerFrame(&analyzerData{
+			fs:       fs,
+			fftWidth: width,
+			wave0:    wave0,
+			envelope: env,
+			spec0:    spec0,
+			spec1:    s.spec1,
+		})
+		return s.spec1
+	})
+	s.Processor.OnFinish(analyzerFinish)
+	return s
+}
+
+// NewShifter は、 o.Method で指定された方法で包絡線を推定するフォルマントシフタを作成します。
+func NewShifter(input *buffer.WaveSource, fs int, config fft.Config, o EnvelopeOptions, shift control.Param) FormantShifter {
+	if o.Method == EnvelopeLPC {
+		return NewLPCShifter(input, fs, config, o, shift)
+	}
+	return NewCepstralShifter(input, fs, config, o, shift)
+}
@@ -0,0 +1,94 @@
+package formant
+
+import (
+	"math"
+	"sort"
+)
+
+// 包絡線の時間方向の平滑化の方法
+const (
+	SmoothingNone   = "none"
+	SmoothingExp    = "exp"
+	SmoothingMedian = "median"
+)
+
+// cepstrumSmoother は、フレームごとに推定した包絡線のケプストラムを時間方向に平滑化します。
+// 指数平滑化と、直近のフレームのメディアンのいずれかを使用できます。
+type cepstrumSmoother struct {
+	method  string
+	coef    float64     // 指数平滑化の追従係数（1フレームあたり）
+	history [][]float64 // メディアンを求める直近のフレームのケプストラム
+	size    int         // メディアンを求めるフレーム数
+	state   []float64
+	values  []float64
+	started bool
+}
+
+// newCepstrumSmoother は、 o の設定に従って cepstrumSmoother を作成します。
+// 平滑化を行わない設定の場合は nil を返します。
+// step はフレームをずらす幅 [サンプル] です。
+func newCepstrumSmoother(fs, width, step int, o EnvelopeOptions) *cepstrumSmoother {
+	if o.Smoothing == "" || o.Smoothing == SmoothingNone || o.SmoothingTau <= 0 {
+		return nil
+	}
+	frames := o.SmoothingTau * float64(fs) / float64(step) // 時定数 [フレーム]
+	return &cepstrumSmoother{
+		method: o.Smoothing,
+		coef:   1 - math.Exp(-1/frames),
+		size:   1 + 2*int(frames+.5),
+		state:  make([]float64, width),
+	}
+}
+
+// reset は、平滑化の状態を破棄し、次のフレームから平滑化をやり直します。
+func (s *cepstrumSmoother) reset() {
+	s.started = false
+	s.history = s.history[:0]
+}
+
+// apply は、ケプストラム ceps を平滑化した結果で上書きします。
+func (s *cepstrumSmoother) apply(ceps []float64) {
+	if s.method == SmoothingMedian {
+		s.applyMedian(ceps)
+		return
+	}
+	if !s.started {
+		copy(s.state, ceps)
+		s.started = true
+		return
+	}
+	for i, v := range ceps {
+		s.state[i] += (v - s.state[i]) * s.coef
+		ceps[i] = s.state[i]
+	}
+}
+
+func (s *cepstrumSmoother) applyMedian(ceps []float64) {
+	var frame []float64
+	if len(s.history) < s.size {
+		frame = make([]float64, len(ceps))
+	} else {
+		// 最も古いフレームのバッファを再利用する
+		frame = s.history[0]
+		s.history = s.history[1:]
+	}
+	copy(frame, ceps)
+	s.history = append(s.history, frame)
+
+	n := len(s.history)
+	if cap(s.values) < n {
+		s.values = make([]float64, n)
+	}
+	values := s.values[:n]
+	for i := range ceps {
+		for j, h := range s.history {
+			values[j] = h[i]
+		}
+		sort.Float64s(values)
+		if n%2 == 1 {
+			ceps[i] = values[n/2]
+		} else {
+			ceps[i] = .5 * (values[n/2-1] + values[n/2])
+		}
+	}
+}
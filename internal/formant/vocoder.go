@@ -0,0 +1,143 @@
+package formant
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/fft"
+)
+
+type phaseVocoder struct {
+	fft.Processor
+	envelope  envelopeEstimator
+	width     int
+	step      int
+	mag       []float64 // 包絡線で平坦化した振幅スペクトル
+	phase     []float64
+	prevPhase []float64
+	omega     []float64 // 各binの瞬時周波数 [rad/sample]
+	peaks     []int
+	outMag    []float64
+	outPhase  []float64
+	synPhase  []float64 // 直前のフレームで各出力binに与えた位相
+	spec1     []complex128
+	fs        int
+	warp      Warp
+}
+
+// NewPhaseVocoder は、位相ボコーダによるピッチシフタを作成します。
+// 基本周波数の推定を必要としないため、ストリーミングや和音を含む入力にも使用できます。
+// 周波数スペクトルを o.Method で指定された方法で推定した包絡線で平坦化してからピッチ係数 pitch 倍に移動し、
+// フォルマントシフトの係数 shift で伸縮した包絡線をかけ直すことで、ピッチシフトに伴うフォルマントのずれを防ぎます。
+// 位相はスペクトルのピークごとに更新し、周辺のbinの位相をピークに固定（identity phase locking）します。
+// 時間伸縮は行わず、分析と合成のフレームの間隔は等しいため、出力の長さは入力と同じです。
+func NewPhaseVocoder(input *buffer.WaveSource, fs int, config fft.Config, o EnvelopeOptions, pitch, shift control.Param) FormantShifter {
+	width := config.Width
+	n := width/2 + 1
+	s := &phaseVocoder{
+		envelope:  newEnvelopeEstimator(fs, config, o),
+		width:     width,
+		step:      config.Step(),
+		mag:       make([]float64, n),
+		phase:     make([]float64, n),
+		prevPhase: make([]float64, n),
+		omega:     make([]float64, n),
+		outMag:    make([]float64, n),
+		outPhase:  make([]float64, n),
+		synPhase:  make([]float64, n),
+		spec1:     make([]complex128, n),
+		fs:        fs,
+		warp:      o.warp(),
+	}
+	step := float64(config.Step()) / float64(fs)
+	pitchSmoother := control.NewSmoother(shiftTau, step)
+	shiftSmoother := control.NewSmoother(shiftTau, step)
+	tiltSmoother := control.NewSmoother(shiftTau, step)
+	frame := 0
+	s.Processor = fft.NewProcessor(input, config, func(spec0 []complex128, wave0 []float64) []complex128 {
+		t := float64(frame) * step
+		frame++
+		if len(spec0) <= 4 {
+			return spec0
+		}
+		f0 := o.f0At(t + float64(width/2)/float64(fs))
+		envelope := s.envelope.estimate(spec0, wave0, f0)
+		o.flattenLow(envelope, fs, f0)
+		s.process(spec0, envelope, pitchSmoother.Next(pitch.At(t)), shiftSmoother.Next(shift.At(t)), tiltSmoother.Next(o.tiltAt(t)))
+		return s.spec1
+	})
+	return s
+}
+
+// wrapPhase は、位相 p を -π..π の範囲に折り返します。
+func wrapPhase(p float64) float64 {
+	return p - 2*math.Pi*math.Floor((p+math.Pi)/(2*math.Pi))
+}
+
+// process は、1フレーム分の周波数スペクトル spec0 をピッチ係数 ratio でシフトし、 s.spec1 に格納します。
+// かけ直す包絡線は、係数 shift で伸縮し、傾き tilt [dB/oct] を加えたものとします。
+func (s *phaseVocoder) process(spec0 []complex128, envelope []float64, ratio, shift, tilt float64) {
+	n := len(spec0)
+	hop := float64(s.step)
+
+	// 平坦化した振幅と瞬時周波数
+	for k, v := range spec0 {
+		s.mag[k] = cmplx.Abs(v) / envelope[k]
+		s.phase[k] = cmplx.Phase(v)
+		center := 2 * math.Pi * float64(k) / float64(s.width)
+		d := wrapPhase(s.phase[k] - s.prevPhase[k] - center*hop)
+		s.omega[k] = center + d/hop
+	}
+	copy(s.prevPhase, s.phase)
+
+	// ピーク検出
+	s.peaks = s.peaks[:0]
+	for k := 1; k < n-1; k++ {
+		if s.mag[k-1] < s.mag[k] && s.mag[k+1] <= s.mag[k] {
+			s.peaks = append(s.peaks, k)
+		}
+	}
+
+	for k := range s.outMag {
+		s.outMag[k] = 0
+	}
+
+	// 各ピークとその影響範囲のbinを、ピークの移動先に合わせて平行移動する
+	for i, p := range s.peaks {
+		lo, hi := 0, n
+		if 0 < i {
+			lo = (s.peaks[i-1] + p + 1) / 2
+		}
+		if i < len(s.peaks)-1 {
+			hi = (p + s.peaks[i+1] + 1) / 2
+		}
+		// ピークの移動量は、binの位置ではなく瞬時周波数から決める
+		k0 := s.omega[p] * float64(s.width) / (2 * math.Pi)
+		q := p + int(math.Floor(k0*(ratio-1)+.5))
+		if q < 1 || n <= q {
+			continue
+		}
+		shiftBins := q - p
+		psi := s.synPhase[q] + s.omega[p]*ratio*hop
+		for k := lo; k < hi; k++ {
+			j := k + shiftBins
+			if j < 1 || n <= j {
+				continue
+			}
+			if s.outMag[j] < s.mag[k] {
+				s.outMag[j] = s.mag[k]
+				s.outPhase[j] = psi + s.phase[k] - s.phase[p]
+			}
+		}
+	}
+
+	// シフトした包絡線をかけ直す
+	s.spec1[0] = spec0[0]
+	for j := 1; j < n; j++ {
+		s.synPhase[j] = wrapPhase(s.outPhase[j])
+		a := s.outMag[j] * envelopeAt(envelope, sourceBin(s.warp, j, n, s.fs, shift)) * tiltGain(j, n, s.fs, tilt)
+		s.spec1[j] = cmplx.Rect(a, s.synPhase[j])
+	}
+}
@@ -0,0 +1,76 @@
+package formant
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/fft"
+	"github.com/but80/voispire/internal/series"
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/fourier"
+)
+
+// runPhaseVocoder は、 src を transpose [半音] だけピッチシフトした結果を返します。
+func runPhaseVocoder(src []float64, fs int, transpose float64) []float64 {
+	input := buffer.NewWaveSource()
+	input.Append(src)
+	input.Close()
+	config := fft.DefaultConfig
+	config.Overlap = 4
+	pitch := control.Const(math.Pow(2, transpose/12))
+	// 正弦波はそれ自体が包絡線のピークとなるため、低域の包絡線を平坦化してピッチのみを移動させる
+	o := EnvelopeOptions{LowCutoff: 2000}
+	p := NewPhaseVocoder(input, fs, config, o, pitch, control.Const(1))
+	p.Start()
+	result := []float64{}
+	for v := range p.Output() {
+		result = append(result, v)
+	}
+	return result
+}
+
+// peakFreq は、 wave の中央付近のスペクトルが最大となる周波数 [Hz] を返します。
+func peakFreq(wave []float64, fs int) float64 {
+	width := 4096
+	frame := make([]float64, width)
+	center := len(wave) / 2
+	series.Hann(width).Apply(frame, wave[center-width/2:center+width/2])
+	spec := fourier.NewFFT(width).Coefficients(nil, frame)
+	peak := 1
+	for i := range spec {
+		if cmplx.Abs(spec[peak]) < cmplx.Abs(spec[i]) {
+			peak = i
+		}
+	}
+	return float64(peak) * float64(fs) / float64(width)
+}
+
+func TestPhaseVocoder(t *testing.T) {
+	const fs = 16000
+	src := make([]float64, fs)
+	for i := range src {
+		src[i] = .5 * math.Sin(2*math.Pi*440*float64(i)/fs)
+	}
+
+	t.Run("12半音上げると周波数が2倍になる", func(t *testing.T) {
+		result := runPhaseVocoder(src, fs, 12)
+		assert.Len(t, result, len(src))
+		assert.InDelta(t, 880, peakFreq(result, fs), 8)
+	})
+
+	t.Run("0半音では入力をほぼそのまま出力する", func(t *testing.T) {
+		result := runPhaseVocoder(src, fs, 0)
+		assert.Len(t, result, len(src))
+		assert.InDelta(t, 440, peakFreq(result, fs), 8)
+		errSum, sum := .0, .0
+		for i := fs / 4; i < fs*3/4; i++ {
+			d := result[i] - src[i]
+			errSum += d * d
+			sum += src[i] * src[i]
+		}
+		assert.InDelta(t, 0, math.Sqrt(errSum/sum), .01)
+	})
+}
@@ -0,0 +1,110 @@
+package formant
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Warp は、フォルマントシフトにおける周波数軸の伸縮方法です。
+type Warp interface {
+	// Source は、シフト量 shift のときに出力の周波数 freq [Hz] へ移す、元の包絡線上の周波数 [Hz] を返します。
+	// nyquist はナイキスト周波数 [Hz] です。
+	Source(freq, nyquist, shift float64) float64
+}
+
+// LinearWarp は、周波数軸全体を一定の比率 shift で伸縮します。
+type LinearWarp struct{}
+
+// Source は、 freq / shift を返します。
+func (LinearWarp) Source(freq, nyquist, shift float64) float64 {
+	return freq / shift
+}
+
+// BilinearWarp は、1次の全域通過フィルタによる周波数軸の伸縮（双一次変換）です。
+// 低域ほど比率 shift に近く伸縮し、ナイキスト周波数は動かさないため、高域に比べて第1・第2フォルマントを大きく移動します。
+type BilinearWarp struct{}
+
+// Source は、低域の傾きが shift となる双一次変換の逆変換により、元の周波数を返します。
+func (BilinearWarp) Source(freq, nyquist, shift float64) float64 {
+	a := -(shift - 1) / (shift + 1) // 逆変換の係数
+	w := math.Pi * freq / nyquist
+	w += 2 * math.Atan2(a*math.Sin(w), 1-a*math.Cos(w))
+	return w / math.Pi * nyquist
+}
+
+// scaledWarp は、前後のピッチシフトによる周波数の移動を線形に打ち消すよう、 Warp を合成した伸縮です。
+// 出力の周波数を最終的な出力の周波数に直してから Warp で元の音声の周波数へ戻し、さらに入力の周波数に直します。
+type scaledWarp struct {
+	Warp
+	in  float64 // 元の音声からフォルマントシフタの入力までの周波数の比率
+	out float64 // フォルマントシフタの出力から最終的な出力までの周波数の比率
+}
+
+// Source は、最終的な出力の周波数をナイキスト周波数までに制限した上で、元の周波数を返します。
+func (w scaledWarp) Source(freq, nyquist, shift float64) float64 {
+	return w.Warp.Source(math.Min(freq*w.out, nyquist), nyquist, shift) * w.in
+}
+
+// PiecewiseWarp は、周波数ごとにシフト量の効き具合を変える区分線形の伸縮です。
+// 周波数 Freqs[i] [Hz] は、比率 shift の Weights[i] 乗だけ移動し、その間は線形に補間されます。
+// 例えば Freqs = {3000, 6000}, Weights = {1, 0} とすると、3kHz までは shift 倍に伸縮し、6kHz 以上は動かしません。
+type PiecewiseWarp struct {
+	Freqs   []float64
+	Weights []float64
+}
+
+// Source は、区分線形の写像の逆変換により、元の周波数を返します。
+func (p PiecewiseWarp) Source(freq, nyquist, shift float64) float64 {
+	// 移動前後の折れ点を順にたどる（移動後が単調増加となるよう補正する）
+	s0, d0 := .0, .0
+	for i, s1 := range p.Freqs {
+		d1 := math.Max(s1*math.Pow(shift, p.Weights[i]), d0)
+		if freq <= d1 {
+			if d1 == d0 {
+				return s0
+			}
+			return lerp(s0, s1, (freq-d0)/(d1-d0))
+		}
+		s0, d0 = s1, d1
+	}
+	// 最後の折れ点より上は、その比率で伸縮する
+	if len(p.Weights) == 0 {
+		return freq
+	}
+	return s0 + (freq-d0)/math.Pow(shift, p.Weights[len(p.Weights)-1])
+}
+
+// ParseWarp は、周波数軸の伸縮方法を表す文字列を解析します。
+// "linear", "bilinear" または "周波数[Hz]:重み" のカンマ区切り（例: "3000:1,6000:0"）を指定できます。
+func ParseWarp(s string) (Warp, error) {
+	switch s {
+	case "", "linear":
+		return LinearWarp{}, nil
+	case "bilinear":
+		return BilinearWarp{}, nil
+	}
+	p := PiecewiseWarp{}
+	for _, point := range strings.Split(s, ",") {
+		fw := strings.Split(strings.TrimSpace(point), ":")
+		if len(fw) != 2 {
+			return nil, xerrors.Errorf("invalid warp point: %s", point)
+		}
+		f, err := strconv.ParseFloat(fw[0], 64)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid warp frequency: %w", err)
+		}
+		w, err := strconv.ParseFloat(fw[1], 64)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid warp weight: %w", err)
+		}
+		if f <= 0 || 0 < len(p.Freqs) && f <= p.Freqs[len(p.Freqs)-1] {
+			return nil, xerrors.Errorf("warp frequencies must be positive and increasing: %s", s)
+		}
+		p.Freqs = append(p.Freqs, f)
+		p.Weights = append(p.Weights, w)
+	}
+	return p, nil
+}
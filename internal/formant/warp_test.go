@@ -0,0 +1,61 @@
+package formant
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarp_Source(t *testing.T) {
+	const nyquist = 8000.0
+	shift := math.Pow(2, 3.0/12.0)
+
+	assert.InDelta(t, 1000/shift, LinearWarp{}.Source(1000, nyquist, shift), 1e-9)
+
+	// 双一次変換は低域ほど shift 倍に近く、ナイキスト周波数は動かない
+	b := BilinearWarp{}
+	assert.InDelta(t, 10/shift, b.Source(10, nyquist, shift), .01)
+	assert.InDelta(t, nyquist, b.Source(nyquist, nyquist, shift), 1e-6)
+	assert.InDelta(t, 0, b.Source(0, nyquist, shift), 1e-9)
+
+	// 区分線形: 3kHz まで shift 倍、6kHz 以上は動かない
+	w, err := ParseWarp("3000:1,6000:0")
+	assert.NoError(t, err)
+	assert.InDelta(t, 1000/shift, w.Source(1000, nyquist, shift), 1e-9)
+	assert.InDelta(t, 3000, w.Source(3000*shift, nyquist, shift), 1e-9)
+	assert.InDelta(t, 7000, w.Source(7000, nyquist, shift), 1e-9)
+
+	// シフト量が 1 のときはどの方法でも恒等写像
+	for _, warp := range []Warp{LinearWarp{}, b, w} {
+		assert.InDelta(t, 1234, warp.Source(1234, nyquist, 1), 1e-9)
+	}
+
+	_, err = ParseWarp("3000:1,2000:0")
+	assert.Error(t, err)
+	_, err = ParseWarp("foo")
+	assert.Error(t, err)
+}
+
+func TestScaledWarp_Source(t *testing.T) {
+	const nyquist = 8000.0
+	shift := math.Pow(2, 3.0/12.0)
+	pitch := math.Pow(2, 5.0/12.0)
+
+	// 線形の伸縮では、従来どおりシフト量をピッチシフトの比率で割った係数と一致する
+	w := scaledWarp{Warp: LinearWarp{}, in: 1, out: pitch}
+	assert.InDelta(t, 1000/(shift/pitch), w.Source(1000, nyquist, shift), 1e-9)
+
+	// 非線形の伸縮は、最終的な出力の周波数に対して、ユーザーが指定したシフト量のみで行う
+	b := BilinearWarp{}
+	w = scaledWarp{Warp: b, in: 1, out: pitch}
+	assert.InDelta(t, b.Source(1000*pitch, nyquist, shift), w.Source(1000, nyquist, shift), 1e-9)
+	// シフト量が 1 のときは、ピッチシフトによるずれを打ち消すだけ
+	assert.InDelta(t, 1000*pitch, w.Source(1000, nyquist, 1), 1e-9)
+	// 最終的な出力でナイキスト周波数を超える帯域は、ナイキスト周波数から取る
+	assert.InDelta(t, nyquist, w.Source(nyquist/pitch*1.1, nyquist, shift), 1e-6)
+
+	// 前段のピッチシフトは、元の音声の周波数から入力の周波数に直す
+	w = scaledWarp{Warp: b, in: pitch, out: 1}
+	assert.InDelta(t, b.Source(1000, nyquist, shift)*pitch, w.Source(1000, nyquist, shift), 1e-9)
+}
@@ -0,0 +1,153 @@
+package gate
+
+import "math"
+
+const (
+	// hysteresis は、ゲートが閉じる閾値を開く閾値からどれだけ下げるか [dB] です。
+	hysteresis = 3.0
+	// floorDb は、ゲートが閉じているときのゲイン [dB] です。
+	floorDb = -80.0
+	// voicingThreshold は、有声とみなす正規化自己相関の最小値です。
+	voicingThreshold = .5
+	// octaveRatio は、基本周期とみなす自己相関の極大の、最大値に対する最小比です。
+	octaveRatio = .9
+)
+
+// Gate は、入力のエネルギー（と任意で有声判定）に基づいて音声区間を検出し、それ以外の区間を減衰させるノイズゲートです。
+type Gate struct {
+	openLevel  float64 // ゲートを開くRMS振幅
+	closeLevel float64 // ゲートを閉じるRMS振幅
+	attack     float64 // ゲインが上がるときの追従係数（1サンプルあたり）
+	release    float64 // ゲインが下がるときの追従係数（1サンプルあたり）
+	floor      float64
+	gain       float64
+	active     bool
+	minLag     int
+	maxLag     int
+	history    []float64
+	useVoicing bool
+}
+
+// New は、新しい Gate を作成します。
+// threshold [dBFS] を超えるブロックを音声区間とみなし、ゲインを attack, release [sec] の時定数で追従させます。
+// useVoicing が true の場合は、有声と判定されたブロックのみを音声区間とします。
+func New(fs int, threshold, attack, release float64, useVoicing bool) *Gate {
+	coef := func(tau float64) float64 {
+		if tau <= 0 {
+			return 1
+		}
+		return 1 - math.Exp(-1/(tau*float64(fs)))
+	}
+	return &Gate{
+		openLevel:  math.Pow(10, threshold/20),
+		closeLevel: math.Pow(10, (threshold-hysteresis)/20),
+		attack:     coef(attack),
+		release:    coef(release),
+		floor:      math.Pow(10, floorDb/20),
+		gain:       math.Pow(10, floorDb/20),
+		minLag:     int(float64(fs) / 800),
+		maxLag:     int(float64(fs) / 71),
+		useVoicing: useVoicing,
+	}
+}
+
+// IsVoiced は、波形 x が有声かどうかを正規化自己相関により判定します。
+// lag の範囲 minLag..maxLag [サンプル] で自己相関のピークを探索します。
+func IsVoiced(x []float64, minLag, maxLag int) bool {
+	_, r := Periodicity(x, minLag, maxLag)
+	return voicingThreshold <= r
+}
+
+// Periodicity は、波形 x の基本周期 [サンプル] と、正規化自己相関の最大値を返します。
+// lag の範囲 minLag..maxLag [サンプル] で探索し、倍周期を誤って選ばないよう、
+// 最大値の octaveRatio 倍以上となる最初の極大を放物線補間した位置を基本周期とします。
+// 探索できない場合は 0, 0 を返します。
+func Periodicity(x []float64, minLag, maxLag int) (float64, float64) {
+	n := len(x)
+	if n <= maxLag+1 || minLag < 2 {
+		return 0, 0
+	}
+	// 極大の判定と補間のため、探索範囲の前後1サンプルも求める
+	corr := make([]float64, maxLag+2)
+	best := .0
+	for lag := minLag - 1; lag <= maxLag+1; lag++ {
+		var r, e0, e1 float64
+		for i := lag; i < n; i++ {
+			r += x[i] * x[i-lag]
+			e0 += x[i] * x[i]
+			e1 += x[i-lag] * x[i-lag]
+		}
+		if e0 == 0 || e1 == 0 {
+			continue
+		}
+		corr[lag] = r / math.Sqrt(e0*e1)
+		if minLag <= lag && lag <= maxLag {
+			best = math.Max(best, corr[lag])
+		}
+	}
+	if best <= 0 {
+		return 0, 0
+	}
+	for lag := minLag; lag <= maxLag; lag++ {
+		c0, c1, c2 := corr[lag-1], corr[lag], corr[lag+1]
+		if c1 < best*octaveRatio || c1 < c0 || c1 < c2 {
+			continue
+		}
+		d := .0
+		if den := c0 - 2*c1 + c2; den < 0 {
+			d = .5 * (c0 - c2) / den
+		}
+		return float64(lag) + d, best
+	}
+	return 0, best
+}
+
+// Active は、直前に処理したブロックが音声区間と判定されたかどうかを返します。
+func (g *Gate) Active() bool {
+	return g.active
+}
+
+// Process は、ブロック block を判定し、ゲインを適用したものを dst に格納します。
+// voiced には外部で判定された有声・無声を与えます。不明な場合は nil とし、 useVoicing が true の場合は自己相関で判定します。
+func (g *Gate) Process(dst, block []float64, voiced *bool) {
+	if len(block) == 0 {
+		return
+	}
+	sum := .0
+	for _, v := range block {
+		sum += v * v
+	}
+	rms := math.Sqrt(sum / float64(len(block)))
+
+	if g.active {
+		g.active = g.closeLevel <= rms
+	} else {
+		g.active = g.openLevel <= rms
+	}
+
+	if g.useVoicing {
+		if voiced == nil {
+			// 最低周波数の2周期分以上の履歴で判定
+			g.history = append(g.history, block...)
+			if n := g.maxLag * 2; n < len(g.history) {
+				g.history = g.history[len(g.history)-n:]
+			}
+			v := IsVoiced(g.history, g.minLag, g.maxLag)
+			voiced = &v
+		}
+		g.active = g.active && *voiced
+	}
+
+	target := g.floor
+	if g.active {
+		target = 1
+	}
+	for i, v := range block {
+		if g.gain < target {
+			g.gain += (target - g.gain) * g.attack
+		} else {
+			g.gain += (target - g.gain) * g.release
+		}
+		dst[i] = v * g.gain
+	}
+}
@@ -0,0 +1,73 @@
+package gate
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sine(n int, freq, amp float64, fs int) []float64 {
+	result := make([]float64, n)
+	for i := range result {
+		result[i] = amp * math.Sin(2*math.Pi*freq*float64(i)/float64(fs))
+	}
+	return result
+}
+
+func TestGate_Process(t *testing.T) {
+	const fs = 16000
+	g := New(fs, -40, .001, .01, false)
+	dst := make([]float64, 256)
+
+	// 閾値を下回る入力は減衰する
+	quiet := sine(256, 200, .001, fs)
+	for i := 0; i < 20; i++ {
+		g.Process(dst, quiet, nil)
+	}
+	assert.False(t, g.Active())
+	assert.True(t, math.Abs(dst[100]) < 1e-5)
+
+	// 閾値を上回る入力は通過する
+	loud := sine(256, 200, .5, fs)
+	for i := 0; i < 20; i++ {
+		g.Process(dst, loud, nil)
+	}
+	assert.True(t, g.Active())
+	assert.InDelta(t, loud[100], dst[100], 1e-3)
+
+	// 有声判定を有効にすると、白色雑音は閾値を上回っても減衰する
+	g = New(fs, -40, .001, .01, true)
+	noise := make([]float64, 256)
+	x := uint32(1)
+	for i := 0; i < 20; i++ {
+		for j := range noise {
+			x = x*1664525 + 1013904223
+			noise[j] = float64(x)/float64(math.MaxUint32) - .5
+		}
+		g.Process(dst, noise, nil)
+	}
+	assert.False(t, g.Active())
+	for i := 0; i < 20; i++ {
+		g.Process(dst, loud, nil)
+	}
+	assert.True(t, g.Active())
+}
+
+func TestPeriodicity(t *testing.T) {
+	const fs = 16000
+	minLag, maxLag := fs/800, fs/71
+	// 倍音を含む 220Hz の波形は、倍周期ではなく基本周期が選ばれる
+	x := sine(maxLag*2, 220, .5, fs)
+	for i, v := range sine(len(x), 440, .4, fs) {
+		x[i] += v
+	}
+	lag, r := Periodicity(x, minLag, maxLag)
+	assert.InDelta(t, float64(fs)/220, lag, .1)
+	assert.True(t, .9 < r, "r=%f", r)
+
+	// 無音は探索できない
+	lag, r = Periodicity(make([]float64, maxLag*2), minLag, maxLag)
+	assert.Equal(t, .0, lag)
+	assert.Equal(t, .0, r)
+}
@@ -0,0 +1,115 @@
+package midi
+
+import (
+	"bufio"
+	"io"
+)
+
+// メッセージの種類
+const (
+	NoteOff         = 0x80
+	NoteOn          = 0x90
+	PolyPressure    = 0xA0
+	ControlChange   = 0xB0
+	ProgramChange   = 0xC0
+	ChannelPressure = 0xD0
+	PitchBend       = 0xE0
+)
+
+// Message は、チャンネルメッセージです。
+type Message struct {
+	Status byte
+	Data1  byte
+	Data2  byte
+}
+
+// Type は、チャンネル番号を除いたメッセージの種類を返します。
+// ベロシティ 0 のノートオンは、ノートオフとして扱います。
+func (m Message) Type() byte {
+	t := m.Status & 0xF0
+	if t == NoteOn && m.Data2 == 0 {
+		return NoteOff
+	}
+	return t
+}
+
+// Channel は、0 から始まるチャンネル番号を返します。
+func (m Message) Channel() int {
+	return int(m.Status & 0x0F)
+}
+
+// dataLen は、ステータスバイト status に続くデータバイトの個数を返します。
+func dataLen(status byte) int {
+	switch status & 0xF0 {
+	case ProgramChange, ChannelPressure:
+		return 1
+	case 0xF0:
+		switch status {
+		case 0xF1, 0xF3:
+			return 1
+		case 0xF2:
+			return 2
+		}
+		return 0
+	}
+	return 2
+}
+
+// Reader は、MIDIポート等のバイト列からチャンネルメッセージを読み込みます。
+// ランニングステータスに対応し、システムメッセージは読み飛ばします。
+type Reader struct {
+	r       *bufio.Reader
+	running byte
+}
+
+// NewReader は、新しい Reader を作成します。
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read は、次のチャンネルメッセージを返します。
+func (r *Reader) Read() (Message, error) {
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return Message{}, err
+		}
+		status := r.running
+		switch {
+		case 0xF8 <= b:
+			// リアルタイムメッセージ
+			continue
+		case b == 0xF0:
+			// システムエクスクルーシブ
+			if _, err := r.r.ReadBytes(0xF7); err != nil {
+				return Message{}, err
+			}
+			r.running = 0
+			continue
+		case 0xF0 < b:
+			// システムコモンメッセージ
+			r.running = 0
+			if _, err := r.r.Discard(dataLen(b)); err != nil {
+				return Message{}, err
+			}
+			continue
+		case 0x80 <= b:
+			status = b
+			r.running = b
+			if b, err = r.r.ReadByte(); err != nil {
+				return Message{}, err
+			}
+		}
+		if status == 0 {
+			// ステータス不明のデータバイト
+			continue
+		}
+		m := Message{Status: status, Data1: b}
+		if dataLen(status) == 2 {
+			if m.Data2, err = r.r.ReadByte(); err != nil {
+				return Message{}, err
+			}
+		}
+		return m, nil
+	}
+}
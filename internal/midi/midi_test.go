@@ -0,0 +1,64 @@
+package midi
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader_Read(t *testing.T) {
+	r := NewReader(bytes.NewReader([]byte{
+		0x90, 60, 100, // note on
+		0xF8,  // timing clock (ignored)
+		64, 0, // running status: note on with velocity 0
+		0xF0, 1, 2, 0xF7, // sysex (ignored)
+		0xB1, 1, 127, // control change on ch.2
+	}))
+
+	m, err := r.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, Message{Status: 0x90, Data1: 60, Data2: 100}, m)
+	assert.Equal(t, byte(NoteOn), m.Type())
+
+	m, err = r.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, Message{Status: 0x90, Data1: 64, Data2: 0}, m)
+	assert.Equal(t, byte(NoteOff), m.Type())
+
+	m, err = r.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(ControlChange), m.Type())
+	assert.Equal(t, 1, m.Channel())
+
+	_, err = r.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestParse(t *testing.T) {
+	data := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6,
+		0, 1, // format 1
+		0, 2, // 2 tracks
+		0, 96, // 96 ticks per quarter note
+		// track 1: tempo = 1 sec per quarter note
+		'M', 'T', 'r', 'k', 0, 0, 0, 11,
+		0, 0xFF, 0x51, 3, 0x0F, 0x42, 0x40,
+		0, 0xFF, 0x2F, 0,
+		// track 2
+		'M', 'T', 'r', 'k', 0, 0, 0, 15,
+		0, 0x90, 60, 100,
+		0x60, 60, 0, // running status
+		0x30, 0x80, 62, 0,
+		0, 0xFF, 0x2F, 0,
+	}
+	events, err := Parse(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, .0, events[0].Time)
+	assert.Equal(t, 1.0, events[1].Time)
+	assert.Equal(t, byte(NoteOff), events[1].Type())
+	assert.Equal(t, 1.5, events[2].Time)
+	assert.Equal(t, byte(62), events[2].Data1)
+}
@@ -0,0 +1,191 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"golang.org/x/xerrors"
+)
+
+// Event は、時刻付きのチャンネルメッセージです。
+type Event struct {
+	// Time は、曲の先頭からの時刻 [sec] です。
+	Time float64
+	Message
+}
+
+// smfEvent は、解析途中のイベントです。
+type smfEvent struct {
+	tick  int
+	order int
+	tempo int // テンポ変更イベントのとき、四分音符あたりのマイクロ秒数
+	msg   Message
+}
+
+// LoadFile は、スタンダードMIDIファイルを読み込み、全トラックのチャンネルメッセージを時刻順に返します。
+func LoadFile(filename string) ([]Event, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, xerrors.Errorf("MIDIファイルのオープンに失敗しました: %s: %w", filename, err)
+	}
+	defer f.Close()
+	events, err := Parse(f)
+	if err != nil {
+		return nil, xerrors.Errorf("MIDIファイルの読み込みに失敗しました: %s: %w", filename, err)
+	}
+	return events, nil
+}
+
+// Parse は、スタンダードMIDIファイルのデータを解析し、全トラックのチャンネルメッセージを時刻順に返します。
+func Parse(r io.Reader) ([]Event, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	id, header, data, err := readChunk(data)
+	if err != nil {
+		return nil, err
+	}
+	if id != "MThd" || len(header) < 6 {
+		return nil, xerrors.New("MThdチャンクがありません")
+	}
+	division := int(binary.BigEndian.Uint16(header[4:]))
+	if division&0x8000 != 0 {
+		return nil, xerrors.New("SMPTEタイムコード形式の分解能には対応していません")
+	}
+
+	var events []smfEvent
+	for 0 < len(data) {
+		var chunk []byte
+		id, chunk, data, err = readChunk(data)
+		if err != nil {
+			return nil, err
+		}
+		if id != "MTrk" {
+			continue
+		}
+		if events, err = parseTrack(events, chunk); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].tick != events[j].tick {
+			return events[i].tick < events[j].tick
+		}
+		return events[i].order < events[j].order
+	})
+
+	// テンポマップに従ってティックを秒に変換
+	result := []Event{}
+	tempo := 500000
+	lastTick := 0
+	t := .0
+	for _, e := range events {
+		t += float64(e.tick-lastTick) * float64(tempo) / 1e6 / float64(division)
+		lastTick = e.tick
+		if 0 < e.tempo {
+			tempo = e.tempo
+			continue
+		}
+		result = append(result, Event{Time: t, Message: e.msg})
+	}
+	return result, nil
+}
+
+func readChunk(data []byte) (string, []byte, []byte, error) {
+	if len(data) < 8 {
+		return "", nil, nil, xerrors.New("チャンクヘッダが不正です")
+	}
+	n := int(binary.BigEndian.Uint32(data[4:]))
+	if len(data)-8 < n {
+		return "", nil, nil, xerrors.New("チャンクサイズが不正です")
+	}
+	return string(data[:4]), data[8 : 8+n], data[8+n:], nil
+}
+
+func readVarLen(r *bytes.Reader) (int, error) {
+	v := 0
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<7 | int(b&0x7F)
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, xerrors.New("可変長数値が不正です")
+}
+
+func parseTrack(events []smfEvent, chunk []byte) ([]smfEvent, error) {
+	r := bytes.NewReader(chunk)
+	tick := 0
+	running := byte(0)
+	for 0 < r.Len() {
+		delta, err := readVarLen(r)
+		if err != nil {
+			return nil, err
+		}
+		tick += delta
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case b == 0xFF:
+			// メタイベント
+			typ, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			n, err := readVarLen(r)
+			if err != nil {
+				return nil, err
+			}
+			body := make([]byte, n)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, err
+			}
+			if typ == 0x51 && n == 3 {
+				tempo := int(body[0])<<16 | int(body[1])<<8 | int(body[2])
+				events = append(events, smfEvent{tick: tick, order: len(events), tempo: tempo})
+			}
+			if typ == 0x2F {
+				return events, nil
+			}
+			continue
+		case b == 0xF0 || b == 0xF7:
+			// システムエクスクルーシブ
+			n, err := readVarLen(r)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := r.Seek(int64(n), io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			continue
+		case 0x80 <= b:
+			running = b
+			if b, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+		case running == 0:
+			return nil, xerrors.New("ランニングステータスが不正です")
+		}
+		m := Message{Status: running, Data1: b}
+		if dataLen(running) == 2 {
+			if m.Data2, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, smfEvent{tick: tick, order: len(events), msg: m})
+	}
+	return events, nil
+}
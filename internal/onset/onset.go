@@ -0,0 +1,53 @@
+package onset
+
+import "math/cmplx"
+
+const (
+	// DefaultThreshold は、オンセットとみなすスペクトルフラックスの既定の閾値です。
+	DefaultThreshold = 1.0
+	// floor は、無音からの立ち上がりでフラックスが発散しないよう、直前のフレームの振幅の和に加える値です。
+	floor = 1e-4
+)
+
+// Detector は、スペクトルフラックスにより音の立ち上がり（オンセット）を検出します。
+type Detector struct {
+	threshold float64
+	prev      []float64
+	flux      float64
+	wasOnset  bool
+}
+
+// New は、新しい Detector を作成します。
+// 直前のフレームからの振幅の増加分の和が、直前のフレームの振幅の和の threshold 倍を超えたときにオンセットとみなします。
+func New(threshold float64) *Detector {
+	return &Detector{
+		threshold: threshold,
+	}
+}
+
+// Flux は、直前に判定したフレームのスペクトルフラックスを返します。
+func (d *Detector) Flux() float64 {
+	return d.flux
+}
+
+// Detect は、周波数スペクトル spec のフレームがオンセットかどうかを返します。
+// 連続するフレームがいずれも閾値を超えた場合は、最初のフレームのみをオンセットとします。
+func (d *Detector) Detect(spec []complex128) bool {
+	if len(d.prev) != len(spec) {
+		d.prev = make([]float64, len(spec))
+	}
+	rise, sum := .0, floor
+	for i, v := range spec {
+		a := cmplx.Abs(v)
+		if d.prev[i] < a {
+			rise += a - d.prev[i]
+		}
+		sum += d.prev[i]
+		d.prev[i] = a
+	}
+	d.flux = rise / sum
+	above := d.threshold < d.flux
+	result := above && !d.wasOnset
+	d.wasOnset = above
+	return result
+}
@@ -0,0 +1,38 @@
+package onset
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/fourier"
+)
+
+func frameSpectrum(amp float64, offset int) []complex128 {
+	const width = 512
+	wave := make([]float64, width)
+	for i := range wave {
+		wave[i] = amp * math.Sin(2*math.Pi*440*float64(i+offset)/16000)
+	}
+	spec := fourier.NewFFT(width).Coefficients(nil, wave)
+	for i := range spec {
+		spec[i] /= width
+	}
+	return spec
+}
+
+func TestDetector_Detect(t *testing.T) {
+	d := New(DefaultThreshold)
+	assert.False(t, d.Detect(frameSpectrum(0, 0)))
+
+	// 無音からの立ち上がりはオンセット
+	assert.True(t, d.Detect(frameSpectrum(.5, 0)))
+
+	// 定常音はオンセットではない
+	for i := 1; i < 10; i++ {
+		assert.False(t, d.Detect(frameSpectrum(.5, i*256)))
+	}
+
+	// 大きく音量が上がるとオンセット
+	assert.True(t, d.Detect(frameSpectrum(2, 10*256)))
+}
@@ -1,6 +1,11 @@
 package series
 
-import "math"
+import (
+	"math"
+	"sort"
+
+	"golang.org/x/xerrors"
+)
 
 // Window は、窓関数から生成される数列です。
 type Window []float64
@@ -127,3 +132,32 @@ func Gauss(n int, sigma float64) Window {
 		return math.Pow(math.E, -.5*u*u)
 	})
 }
+
+var windowFuncs = map[string]func(n int) Window{
+	"rect":           Rect,
+	"hann":           Hann,
+	"sqrthann":       SqrtHann,
+	"hamming":        Hamming,
+	"blackmanharris": BlackmanHarris,
+	"nuttall":        Nuttall,
+	"bartlett":       Bartlett,
+}
+
+// WindowNames は、 Named で指定できる窓関数の名前の一覧を返します。
+func WindowNames() []string {
+	result := make([]string, 0, len(windowFuncs))
+	for name := range windowFuncs {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Named は、名前 name の窓関数を長さ n で生成します。
+func Named(name string, n int) (Window, error) {
+	fn, ok := windowFuncs[name]
+	if !ok {
+		return nil, xerrors.Errorf("unknown window function: %s", name)
+	}
+	return fn(n), nil
+}
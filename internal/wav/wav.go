@@ -90,12 +90,13 @@ func Load(filename string) ([]float64, int, error) {
 	return result, int(inInfo.Samplerate), nil
 }
 
-// StartSave は、モノラルの []float64 をwavファイルとして保存するゴルーチンを開始します。
-func StartSave(filename string, fs int) (chan<- []float64, <-chan struct{}, error) {
+// StartSave は、 []float64 をwavファイルとして保存するゴルーチンを開始します。
+// channels が 2 以上の場合、各チャンネルのサンプルが交互に並んでいるものとして扱います。
+func StartSave(filename string, fs, channels int) (chan<- []float64, <-chan struct{}, error) {
 	outInfo := sndfile.Info{
 		// Frames:     int64(len(data)),
 		Samplerate: int32(fs),
-		Channels:   1,
+		Channels:   int32(channels),
 		Format:     sndfile.SF_FORMAT_WAV | sndfile.SF_FORMAT_PCM_16,
 	}
 	log.Printf("debug: sndfile.Info = %#v", outInfo)
@@ -128,16 +129,17 @@ func StartSave(filename string, fs int) (chan<- []float64, <-chan struct{}, erro
 				} else if 1.0 < v {
 					data[i] = 1.0
 				}
-				if iLastClip+fs <= i {
-					log.Printf("warn: クリッピングが発生しました: %.3f sec", float64(i)/float64(fs))
-					iLastClip = i
+				j := iCurrent + i/channels
+				if iLastClip+fs <= j {
+					log.Printf("warn: クリッピングが発生しました: %.3f sec", float64(j)/float64(fs))
+					iLastClip = j
 				}
 			}
 			if _, err := fout.WriteFrames(data); err != nil {
 				log.Printf("error: 出力音声ファイルの書き込みに失敗しました: %s: %s", filename, err)
 				break
 			}
-			iCurrent += len(data)
+			iCurrent += len(data) / channels
 		}
 	}()
 	return ch, wait, nil
@@ -13,12 +13,14 @@ func toDoublePtr(a []float64) *C.double {
 	return (*C.double)(&a[0])
 }
 
+// Harvest は、波形 x の基本周波数をフレームピリオド framePeriod [msec] ごとに推定します。
+// 各フレームの基本周波数 [Hz] （無声のとき 0）と、その時刻 [sec] を返します。
 func Harvest(x []float64, fs int, framePeriod, f0Floor, f0Ceil float64) ([]float64, []float64) {
 	xLength := len(x)
 	var option C.HarvestOption
 	option.f0_floor = C.double(f0Floor)
 	option.f0_ceil = C.double(f0Ceil)
-	option.frame_period = C.double(framePeriod) * 1000.0
+	option.frame_period = C.double(framePeriod)
 	f0Length := C.GetSamplesForHarvest(
 		C.int(fs),
 		C.int(xLength),
@@ -0,0 +1,98 @@
+package voispire
+
+import (
+	"sync"
+
+	"github.com/but80/voispire/internal/gate"
+)
+
+const (
+	// liveF0Hop は、入力から逐次推定する基本周波数の更新間隔 [sec] です。
+	liveF0Hop = .005
+	// liveF0Rate は、基本周波数の推定に用いる、間引き後のサンプリング周波数の目安 [Hz] です。
+	liveF0Rate = 11025.0
+	// liveF0Voicing は、有声とみなす正規化自己相関の最小値です。
+	liveF0Voicing = .6
+)
+
+// liveF0 は、入力の波形から基本周波数を逐次推定します。
+// 入力ファイルを事前に解析できないオーディオデバイスからの入力で、 f0track.Track の代わりに使用します。
+// 推定は直近の最低周波数の2周期分の波形の自己相関によるため、入力に対して遅れが生じます。
+type liveF0 struct {
+	fs      float64
+	decim   int       // 間引きの比率
+	hop     int       // 推定の間隔 [入力サンプル]
+	minLag  int       // 探索する周期の範囲 [間引き後のサンプル]
+	maxLag  int       //
+	history []float64 // 間引き後の直近の波形
+	sum     float64   // 間引き中のサンプルの和
+	count   int       // 入力済みのサンプル数
+	values  []float64 // hop ごとの推定値 [Hz]（無声のときは 0）
+	mutex   sync.RWMutex
+}
+
+func newLiveF0(fs float64) *liveF0 {
+	decim := int(fs / liveF0Rate)
+	if decim < 1 {
+		decim = 1
+	}
+	rate := fs / float64(decim)
+	hop := int(liveF0Hop * fs)
+	if hop < decim {
+		hop = decim
+	}
+	return &liveF0{
+		fs:     fs,
+		decim:  decim,
+		hop:    hop / decim * decim,
+		minLag: int(rate / f0Ceil),
+		maxLag: int(rate/f0Floor) + 1,
+	}
+}
+
+// push は、入力のサンプル v を追加し、 hop サンプルごとに基本周波数を推定します。
+func (e *liveF0) push(v float64) {
+	e.count++
+	e.sum += v
+	if e.count%e.decim == 0 {
+		// 平均をとってから間引く
+		e.history = append(e.history, e.sum/float64(e.decim))
+		e.sum = 0
+		if n := e.maxLag * 2; n < len(e.history) {
+			e.history = e.history[len(e.history)-n:]
+		}
+	}
+	if e.count%e.hop != 0 {
+		return
+	}
+	freq := .0
+	if lag, r := gate.Periodicity(e.history, e.minLag, e.maxLag); 0 < lag && liveF0Voicing <= r {
+		freq = e.fs / float64(e.decim) / lag
+	}
+	e.mutex.Lock()
+	e.values = append(e.values, freq)
+	e.mutex.Unlock()
+}
+
+// At は、入力の時刻 t [sec] における基本周波数 [Hz] と、有声かどうかを返します。
+// まだ推定していない時刻は、最新の推定値を返します。
+func (e *liveF0) At(t float64) (float64, bool) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	n := len(e.values)
+	if n == 0 || t < 0 {
+		return 0, false
+	}
+	// t を含む区間を推定した最初の値
+	i := int(t * e.fs / float64(e.hop))
+	if n <= i {
+		i = n - 1
+	}
+	return e.values[i], 0 < e.values[i]
+}
+
+// Freq は、入力の時刻 t [sec] における基本周波数 [Hz] を返します。無声の場合は 0 を返します。
+func (e *liveF0) Freq(t float64) float64 {
+	v, _ := e.At(t)
+	return v
+}
@@ -0,0 +1,56 @@
+package voispire
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveF0(t *testing.T) {
+	const fs = 44100
+	e := newLiveF0(fs)
+	_, ok := e.At(0)
+	assert.False(t, ok)
+
+	// 0.5秒の無音に続いて、倍音を含む 220Hz の声
+	for i := 0; i < fs; i++ {
+		v := .0
+		if fs/2 <= i {
+			x := 2 * math.Pi * 220 * float64(i) / fs
+			v = .5*math.Sin(x) + .3*math.Sin(2*x) + .1*math.Sin(3*x)
+		}
+		e.push(v)
+	}
+	_, ok = e.At(.25)
+	assert.False(t, ok)
+	// 推定の窓が声で満たされた以降は、基本周波数を追従する
+	for _, at := range []float64{.55, .75, .99} {
+		f0, ok := e.At(at)
+		assert.True(t, ok, "t=%g", at)
+		assert.InDelta(t, 0, 1200*math.Log2(f0/220), 10, "t=%g f0=%f", at, f0)
+	}
+	// まだ推定していない時刻は最新の値
+	assert.Equal(t, e.Freq(.999), e.Freq(10))
+}
+
+func TestF0Splitter_live(t *testing.T) {
+	const fs = 44100
+	input := make(chan float64, fs)
+	for i := 0; i < fs/2; i++ {
+		input <- math.Sin(2 * math.Pi * 220 * float64(i) / fs)
+	}
+	close(input)
+	s := newF0Splitter(nil, fs, false)
+	s.live = newLiveF0(fs)
+	s.input = input
+	s.Start()
+	lengths := []int{}
+	for shape := range s.output {
+		lengths = append(lengths, len(shape.Data()))
+	}
+	// 推定が始まった以降は、推定した基本周期で区切られる（末尾は入力の残り）
+	for _, n := range lengths[len(lengths)/2 : len(lengths)-1] {
+		assert.InDelta(t, fs/220.0, n, 1.5)
+	}
+}
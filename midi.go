@@ -0,0 +1,133 @@
+package voispire
+
+import (
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/midi"
+	"github.com/xlab/closer"
+)
+
+const (
+	// midiCCFormant は、フォルマントシフト量に割り当てるコントロールチェンジ番号です（モジュレーションホイール）。
+	midiCCFormant = 1
+	// midiCCMix は、ミックス比率に割り当てるコントロールチェンジ番号です（エフェクト1デプス）。
+	midiCCMix = 91
+)
+
+// midiState は、MIDIメッセージを解釈し、パラメータの変更に変換します。
+type midiState struct {
+	// notes は、押下中のノート番号です（後着優先）。
+	notes []byte
+}
+
+func noteToFreq(note byte) float64 {
+	return 440.0 * math.Pow(2.0, (float64(note)-69.0)/12.0)
+}
+
+// ccToSemitones は、コントロールチェンジの値 0..127 を -12..12 [半音] に変換します（64 が 0）。
+func ccToSemitones(v byte) float64 {
+	if v < 64 {
+		return (float64(v) - 64.0) * 12.0 / 64.0
+	}
+	return (float64(v) - 64.0) * 12.0 / 63.0
+}
+
+func (m *midiState) removeNote(note byte) {
+	for i, n := range m.notes {
+		if n == note {
+			m.notes = append(m.notes[:i], m.notes[i+1:]...)
+			return
+		}
+	}
+}
+
+// handle は、MIDIメッセージ msg に応じて set を呼び出します。
+// ノートは目標の基本周波数 "note" に、コントロールチェンジはフォルマントシフト量 "formant" およびミックス比率 "mix" に対応します。
+func (m *midiState) handle(msg midi.Message, set control.Handler) {
+	switch msg.Type() {
+	case midi.NoteOn:
+		m.removeNote(msg.Data1)
+		m.notes = append(m.notes, msg.Data1)
+		set("note", noteToFreq(msg.Data1))
+	case midi.NoteOff:
+		m.removeNote(msg.Data1)
+		if len(m.notes) == 0 {
+			set("note", 0)
+		} else {
+			set("note", noteToFreq(m.notes[len(m.notes)-1]))
+		}
+	case midi.ControlChange:
+		switch msg.Data1 {
+		case midiCCFormant:
+			set("formant", ccToSemitones(msg.Data2))
+		case midiCCMix:
+			set("mix", float64(msg.Data2)/127.0)
+		}
+	}
+}
+
+func isMIDIFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".mid" || ext == ".midi"
+}
+
+// listenMIDI は、MIDI入力によるパラメータ操作を開始します。
+// port がMIDIファイルの場合は、その内容を入力の先頭に合わせて再生するよう c に設定します。
+// それ以外の場合は、 port をMIDIポートのデバイスファイル（/dev/snd/midiC1D0 や名前付きパイプ等）として読み込みます。
+func (c *controller) listenMIDI(port string) error {
+	if !c.noteEnabled {
+		log.Print("warn: 入力の基本周波数を推定しないため、ノートによるピッチ操作は無効です（ピッチシフト量に従います）")
+	}
+	state := &midiState{}
+
+	if isMIDIFile(port) {
+		events, err := midi.LoadFile(port)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			state.handle(e.Message, func(name string, v float64) {
+				tl, ok := c.tracks[name]
+				if !ok {
+					tl = control.NewTimeline(c.value(name).Get())
+					c.tracks[name] = tl
+				}
+				tl.Add(e.Time, v)
+			})
+		}
+		log.Printf("info: MIDIファイルを読み込みました: %s (%d events)", port, len(events))
+		return nil
+	}
+
+	go func() {
+		// 名前付きパイプは書き込み側が開くまでブロックするため、ゴルーチン内で開く
+		f, err := os.Open(port)
+		if err != nil {
+			log.Printf("error: MIDIポートのオープンに失敗しました: %s: %s", port, err)
+			return
+		}
+		closer.Bind(func() {
+			log.Print("debug: closing MIDI port")
+			f.Close()
+		})
+		log.Printf("info: MIDIポートを開きました: %s", port)
+		r := midi.NewReader(f)
+		for {
+			msg, err := r.Read()
+			if err != nil {
+				if err != io.EOF {
+					log.Printf("error: MIDIポートの読み込みに失敗しました: %s: %s", port, err)
+				}
+				return
+			}
+			state.handle(msg, c.set)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,154 @@
+package voispire
+
+import (
+	"log"
+	"math"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
+)
+
+const (
+	// limiterThreshold は、リミッタが動作し始める振幅です。
+	limiterThreshold = .9
+	// limiterRelease は、リミッタのリリース時間 [sec] です。
+	limiterRelease = .1
+	// mixTau は、ミックス比率の変更に追従する時定数 [sec] です。
+	mixTau = .03
+)
+
+// waveReader は、 WaveSource を先頭から順に読み込みます。
+type waveReader struct {
+	src   *buffer.WaveSource
+	begin int
+	buf   []float64
+	eof   bool
+}
+
+// at は、位置 i のサンプルを返します。範囲外の位置では 0 を返します。
+// 一度読み込んだ位置より手前の位置は、直前の読み込み範囲内のみ指定できます。
+func (r *waveReader) at(i int) float64 {
+	const step = 4096
+	if i < r.begin {
+		return 0
+	}
+	for r.begin+len(r.buf) <= i {
+		if r.eof {
+			return 0
+		}
+		// 直前のサンプルを補間に使えるよう、1サンプル残して読み進める
+		next := r.begin + len(r.buf) - 1
+		if next < r.begin {
+			next = r.begin
+		}
+		r.src.DiscardUntil(next)
+		data, ok := r.src.Read(next, next+step)
+		r.begin = next
+		r.buf = data
+		r.eof = !ok
+	}
+	return r.buf[i-r.begin]
+}
+
+// mixer は、変換前の入力（ドライ）と変換後の出力（ウェット）を混合し、出力ゲインとリミッタを適用します。
+// ドライはウェットの遅延に合わせて遅らせ、サンプリング周波数の違いは線形補間で揃えます。
+type mixer struct {
+	output   chan float64
+	prev     interface{ Start() }
+	dry      *buffer.WaveSource
+	wet      <-chan float64
+	channels int
+	mix      control.Param
+	gain     float64
+	limit    bool
+	fs       float64
+	// resampleCoef は、ドライに対するウェットのサンプリング周波数の比です。
+	resampleCoef float64
+	// latency は、ドライに対するウェットの遅延 [ドライのサンプル] を返します。
+	// ウェットの最初のサンプルを受信した後に呼び出されます。
+	latency func() int
+}
+
+func newMixer(prev interface{ Start() }, dry *buffer.WaveSource, wet <-chan float64, channels int, fs float64, mix control.Param, gainDb float64, limit bool) *mixer {
+	return &mixer{
+		output:       make(chan float64, 4096),
+		prev:         prev,
+		dry:          dry,
+		wet:          wet,
+		channels:     channels,
+		mix:          mix,
+		gain:         math.Pow(10.0, gainDb/20.0),
+		limit:        limit,
+		fs:           fs,
+		resampleCoef: 1.0,
+		latency: func() int {
+			return 0
+		},
+	}
+}
+
+func (m *mixer) Start() {
+	m.prev.Start()
+	go func() {
+		log.Print("debug: mixer goroutine is started")
+		dry := &waveReader{src: m.dry}
+		frame := make([]float64, m.channels)
+		release := math.Exp(-1.0 / (limiterRelease * m.fs * m.resampleCoef))
+		env := .0
+		latency := 0
+		smoother := control.NewSmoother(mixTau, 1.0/(m.fs*m.resampleCoef))
+		n := 0
+		for {
+			for i := range frame {
+				v, ok := <-m.wet
+				if !ok {
+					log.Printf("debug: mixer %d messages", n)
+					close(m.output)
+					return
+				}
+				frame[i] = v
+			}
+			if n == 0 {
+				latency = m.latency()
+				log.Printf("debug: mixer latency = %d samples", latency)
+			}
+
+			// ウェットと同じ時刻のドライを線形補間で取得
+			t := float64(n) / m.resampleCoef
+			p := t - float64(latency)
+			d := .0
+			if 0 <= p {
+				i, f := math.Modf(p)
+				d = lerp(dry.at(int(i)), dry.at(int(i)+1), f)
+			}
+
+			mix := smoother.Next(m.mix.At(t / m.fs))
+			peak := .0
+			for i, v := range frame {
+				v = (v*mix + d*(1-mix)) * m.gain
+				frame[i] = v
+				peak = math.Max(peak, math.Abs(v))
+			}
+
+			if m.limit {
+				// アタック 0 のピークホールドに対してゲインを下げる
+				env = math.Max(peak, env*release)
+				if limiterThreshold < env {
+					g := limiterThreshold / env
+					for i := range frame {
+						frame[i] *= g
+					}
+				}
+			}
+
+			for _, v := range frame {
+				m.output <- v
+			}
+			n++
+		}
+	}()
+}
+
+func lerp(a, b, t float64) float64 {
+	return a*(1-t) + b*t
+}
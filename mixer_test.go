@@ -0,0 +1,95 @@
+package voispire
+
+import (
+	"math"
+	"testing"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
+	"github.com/stretchr/testify/assert"
+)
+
+type nopStarter struct{}
+
+func (nopStarter) Start() {}
+
+// runMixer は、ドライ dry とウェット wet を混合した結果を返します。
+func runMixer(dry, wet []float64, latency int, mix, gainDb float64, limit bool) []float64 {
+	src := buffer.NewWaveSource()
+	src.Append(dry)
+	src.Close()
+	ch := make(chan float64, len(wet))
+	for _, v := range wet {
+		ch <- v
+	}
+	close(ch)
+	m := newMixer(nopStarter{}, src, ch, 1, 8000, control.Const(mix), gainDb, limit)
+	m.latency = func() int {
+		return latency
+	}
+	m.Start()
+	result := []float64{}
+	for v := range m.output {
+		result = append(result, v)
+	}
+	return result
+}
+
+func testSignal(n int, seed float64) []float64 {
+	result := make([]float64, n)
+	for i := range result {
+		result[i] = .5 * math.Sin(seed*float64(i)+seed)
+	}
+	return result
+}
+
+func TestMixer(t *testing.T) {
+	const n = 1000
+	const latency = 37
+	dry := testSignal(n, .1)
+	wet := testSignal(n, .37)
+
+	t.Run("mix=0 はレイテンシ分遅らせたドライを出力する", func(t *testing.T) {
+		out := runMixer(dry, wet, latency, 0, 0, false)
+		assert.Len(t, out, n)
+		for i := 0; i < latency; i++ {
+			assert.Equal(t, .0, out[i])
+		}
+		for i := latency; i < n; i++ {
+			assert.InDelta(t, dry[i-latency], out[i], 1e-12)
+		}
+	})
+
+	t.Run("mix=1 はウェットをそのまま出力する", func(t *testing.T) {
+		out := runMixer(dry, wet, latency, 1, 0, false)
+		assert.Len(t, out, n)
+		for i := range out {
+			assert.InDelta(t, wet[i], out[i], 1e-12)
+		}
+	})
+
+	t.Run("ゲインを dB で適用する", func(t *testing.T) {
+		out := runMixer(dry, wet, latency, 1, -6, false)
+		g := math.Pow(10, -6.0/20)
+		for i := range out {
+			assert.InDelta(t, wet[i]*g, out[i], 1e-12)
+		}
+	})
+
+	t.Run("リミッタは過大な入力をしきい値以下に抑える", func(t *testing.T) {
+		loud := make([]float64, n)
+		for i := range loud {
+			loud[i] = 4 * math.Sin(.37*float64(i))
+		}
+		out := runMixer(dry, loud, latency, 1, 6, true)
+		peak := .0
+		for _, v := range out {
+			assert.True(t, math.Abs(v) <= limiterThreshold+1e-12)
+			peak = math.Max(peak, math.Abs(v))
+		}
+		assert.InDelta(t, limiterThreshold, peak, .01)
+
+		quiet := runMixer(dry, wet, latency, 1, 0, true)
+		assert.InDeltaSlice(t, wet, quiet, 1e-12)
+	})
+}
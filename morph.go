@@ -0,0 +1,158 @@
+package voispire
+
+import (
+	"math"
+
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/dtw"
+	"github.com/but80/voispire/internal/f0track"
+	"github.com/but80/voispire/internal/fft"
+	"github.com/but80/voispire/internal/formant"
+	"github.com/but80/voispire/internal/wav"
+	"github.com/but80/voispire/internal/world"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// morphFeatureOrder は、発話の対応付けに使用するケプストラムの次数です。
+	morphFeatureOrder = 24
+	// morphSlopeTime は、時間伸縮の傾きを求める区間の片側の長さ [sec] です。
+	morphSlopeTime = .05
+	// minMorphSpeed, maxMorphSpeed は、モーフィングによる速度係数の範囲です。
+	minMorphSpeed = .25
+	maxMorphSpeed = 4.0
+)
+
+// morph は、同じ内容の2つの発話を動的時間伸縮で対応付け、包絡線・基本周波数・タイミングをその間で補間します。
+// 時刻はすべて入力（モーフィング元）の時刻 [sec] です。
+type morph struct {
+	ratio  control.Param  // モーフィングの比率（0: 入力, 1: 相手）
+	period float64        // フレームの間隔 [sec]
+	path   []float64      // 入力の各フレームに対応する相手のフレーム位置
+	f0     *f0track.Track // 相手の基本周波数
+	envA   [][]float64    // 入力の各フレームの包絡線の対数振幅
+	envB   [][]float64    // 相手の各フレームの包絡線の対数振幅
+}
+
+// cepstralFeatures は、包絡線の対数振幅 env から、発話の対応付けに使用するケプストラムを求めます。
+// 音量に相当する0次の係数は除きます。
+func cepstralFeatures(env []float64) []float64 {
+	n := float64(len(env))
+	result := make([]float64, morphFeatureOrder)
+	for k := range result {
+		c := .0
+		for j, e := range env {
+			c += e * math.Cos(math.Pi*float64(k+1)*(float64(j)+.5)/n)
+		}
+		result[k] = c / n
+	}
+	return result
+}
+
+// newMorph は、サンプリング周波数 fs の波形 a, b とそれぞれの基本周波数から morph を作成します。
+func newMorph(a []float64, f0A *f0track.Track, b []float64, f0B *f0track.Track, fs int, config fft.Config, o formant.EnvelopeOptions, ratio control.Param) (*morph, error) {
+	oA, oB := o, o
+	oA.F0 = control.Func(f0A.Freq)
+	oB.F0 = control.Func(f0B.Freq)
+	envA := formant.LogEnvelopes(a, fs, config, oA)
+	envB := formant.LogEnvelopes(b, fs, config, oB)
+	if len(envA) == 0 || len(envB) == 0 {
+		return nil, xerrors.New("音声が短すぎます")
+	}
+	featA := make([][]float64, len(envA))
+	for i, env := range envA {
+		featA[i] = cepstralFeatures(env)
+	}
+	featB := make([][]float64, len(envB))
+	for i, env := range envB {
+		featB[i] = cepstralFeatures(env)
+	}
+	return &morph{
+		ratio:  ratio,
+		period: float64(config.Step()) / float64(fs),
+		path:   dtw.Align(featA, featB),
+		f0:     f0B,
+		envA:   envA,
+		envB:   envB,
+	}, nil
+}
+
+// loadMorph は、音声ファイル filename をモーフィングの相手として読み込み、入力の波形 src と対応付けます。
+func loadMorph(filename string, src []float64, f0 *f0track.Track, fs int, framePeriodMsec float64, config fft.Config, o formant.EnvelopeOptions, ratio control.Param) (*morph, error) {
+	wave, fsB, err := wav.Load(filename)
+	if err != nil {
+		return nil, xerrors.Errorf("音声ファイルの読み込みに失敗しました: %w", err)
+	}
+	if fsB != fs {
+		return nil, xerrors.Errorf("サンプリング周波数が入力と異なります (%d != %d)", fsB, fs)
+	}
+	f0B := f0track.FromHarvest(world.Harvest(wave, fs, framePeriodMsec, f0Floor, f0Ceil))
+	return newMorph(src, f0, wave, f0B, fs, config, o, ratio)
+}
+
+// ratioAt は、時刻 t におけるモーフィングの比率を 0..1 の範囲で返します。
+func (m *morph) ratioAt(t float64) float64 {
+	return clamp(m.ratio.At(t), 0, 1)
+}
+
+// pathAt は、入力のフレーム位置 i に対応する相手のフレーム位置を線形補間して返します。
+func (m *morph) pathAt(i float64) float64 {
+	n := len(m.path)
+	i = clamp(i, 0, float64(n-1))
+	i0 := int(i)
+	if n-1 <= i0 {
+		return m.path[n-1]
+	}
+	f := i - float64(i0)
+	return m.path[i0]*(1-f) + m.path[i0+1]*f
+}
+
+// f0Map は、時刻 t における入力の基本周波数 f0 [Hz] を、相手の基本周波数との間で対数補間した値を返します。
+// 相手が無声のときは f0 をそのまま返します。
+func (m *morph) f0Map(t, f0 float64) float64 {
+	f0B := m.f0.Freq(m.pathAt(t/m.period) * m.period)
+	if f0B <= 0 {
+		return f0
+	}
+	r := m.ratioAt(t)
+	return math.Exp(math.Log(f0)*(1-r) + math.Log(f0B)*r)
+}
+
+// speed は、時刻 t における速度係数（出力の時間あたりに進む入力の時間）を返します。
+// 出力の時間軸は、入力と相手の時間軸をモーフィングの比率で補間したものとなります。
+func (m *morph) speed(t float64) float64 {
+	i := t / m.period
+	k := math.Max(1, math.Round(morphSlopeTime/m.period))
+	slope := (m.pathAt(i+k) - m.pathAt(i-k)) / (2 * k)
+	r := m.ratioAt(t)
+	d := (1 - r) + r*slope
+	if d <= 0 {
+		return maxMorphSpeed
+	}
+	return clamp(1/d, minMorphSpeed, maxMorphSpeed)
+}
+
+// envelopeMapping は、入力の包絡線を相手の包絡線に近づけるフレームごとの補正を返します。
+func (m *morph) envelopeMapping() *formant.EnvelopeMapping {
+	frames := make([][]float64, len(m.envA))
+	for i, envA := range m.envA {
+		r := m.ratioAt(float64(i) * m.period)
+		j := clamp(m.path[i], 0, float64(len(m.envB)-1))
+		j0 := int(j)
+		j1 := j0
+		if j1 < len(m.envB)-1 {
+			j1++
+		}
+		f := j - float64(j0)
+		gain := make([]float64, len(envA))
+		for k, a := range envA {
+			b := m.envB[j0][k]*(1-f) + m.envB[j1][k]*f
+			gain[k] = (b - a) * r
+		}
+		frames[i] = gain
+	}
+	return &formant.EnvelopeMapping{
+		Frames:      frames,
+		FramePeriod: m.period,
+	}
+}
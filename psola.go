@@ -0,0 +1,160 @@
+package voispire
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
+)
+
+// psolaMark は、ピッチマークとそこから始まる1周期分の波形です。
+type psolaMark struct {
+	pos   int
+	shape buffer.Shape
+}
+
+// sampleAt は、 data の位置 x [サンプル] における線形補間された振幅を返します。範囲外は端の値とします。
+func sampleAt(data []float64, x float64) float64 {
+	n := len(data)
+	if n == 0 {
+		return 0
+	}
+	if x <= 0 {
+		return data[0]
+	}
+	i, f := math.Modf(x)
+	i0 := int(i)
+	if n-1 <= i0 {
+		return data[n-1]
+	}
+	return data[i0]*(1-f) + data[i0+1]*f
+}
+
+// addGrain は、ピッチマーク cur を中心とする2周期分の波形に窓がけし、 out の位置 center [出力サンプル] に加算します。
+// prev は直前のピッチマークで、 nil の場合は左半分を無音とします。
+// 窓の左右はそれぞれ直前・当該周期の長さのハン窓の半分で、 resampleCoef 倍に伸縮し、 gain 倍して配置します。
+func addGrain(out []float64, outBase int, center float64, prev, cur *psolaMark, resampleCoef, gain float64) {
+	r := cur.shape.Data()
+	pr := float64(len(r))
+	begin := int(math.Ceil(center))
+	if prev != nil {
+		l := prev.shape.Data()
+		pl := float64(len(l))
+		begin = int(math.Ceil(center - pl*resampleCoef))
+		if begin < outBase {
+			// 出力の先頭より前の部分は捨てる
+			begin = outBase
+		}
+		for u := begin; u < int(math.Ceil(center)); u++ {
+			a := (float64(u)-center)/resampleCoef + pl
+			w := gain * .5 * (1 - math.Cos(math.Pi*a/pl))
+			out[u-outBase] += w * sampleAt(l, a)
+		}
+	}
+	end := center + pr*resampleCoef
+	for u := int(math.Ceil(center)); float64(u) < end; u++ {
+		a := (float64(u) - center) / resampleCoef
+		w := gain * .5 * (1 + math.Cos(math.Pi*a/pr))
+		out[u-outBase] += w * sampleAt(r, a)
+	}
+}
+
+// startPSOLA は、TD-PSOLA（時間領域ピッチ同期波形重畳加算）により波形を生成します。
+// 各周期の開始位置をピッチマークとみなし、その前後2周期分に窓がけした素片を、
+// ピッチ係数で間隔を変えた合成マークの位置に重ねて配置します。
+func (s *stretcher) startPSOLA() {
+	go func() {
+		log.Print("debug: stretcher goroutine is started (psola)")
+		marks := []psolaMark{}
+		m := 0      // 合成マークに対応するピッチマークの marks 内の位置
+		pos := 0    // 次に入力される周期の開始位置 [入力サンプル]
+		synth := .0 // 次の合成マークの位置 [出力サンプル]
+		tau := .0   // 合成マークに対応する入力上の位置 [入力サンプル]
+		out := []float64{}
+		outBase := 0 // out の先頭の位置 [出力サンプル]
+		maxHalf := int(math.Ceil(s.fs / f0Floor * s.resampleCoef))
+		smoother := control.NewSmoother(pitchTau, 0)
+		msg := 0
+		var busy time.Duration
+
+		emit := func(until int) {
+			n := until - outBase
+			if n <= 0 {
+				return
+			}
+			result := make([]float64, n)
+			copy(result, out[:n])
+			s.output <- buffer.MakeShape(result)
+			msg++
+			out = out[n:]
+			outBase = until
+		}
+
+		synthesize := func(final bool) {
+			for {
+				last := len(marks) - 1
+				if final {
+					if float64(pos) <= tau {
+						return
+					}
+				} else if float64(marks[last].pos) < tau {
+					// 次の周期が入力されるまで、最も近いピッチマークが確定しない
+					return
+				}
+				for m < last && math.Abs(float64(marks[m+1].pos)-tau) <= math.Abs(float64(marks[m].pos)-tau) {
+					m++
+				}
+				cur := &marks[m]
+				var prev *psolaMark
+				if 0 < m {
+					prev = &marks[m-1]
+				}
+				period := float64(len(cur.shape.Data()))
+				t := float64(cur.pos) / s.fs
+				contour := s.contour.At(t)
+				pitchCoef := smoother.NextAfter(s.pitchCoef.At(t)/contour, period/s.fs) * contour
+				speedCoef := s.speedCoef.At(tau / s.fs)
+				if s.transient != nil && s.transient(t) {
+					// 隣り合うピッチマークを元の間隔で並べると、入力がそのまま再構成される
+					pitchCoef, speedCoef = 1, 1
+				}
+
+				end := int(math.Ceil(synth+period*s.resampleCoef)) + 1
+				for len(out) < end-outBase {
+					out = append(out, 0)
+				}
+				addGrain(out, outBase, synth, prev, cur, s.resampleCoef, s.gain.At(t))
+				step := period * s.resampleCoef / pitchCoef
+				synth += step
+				tau += step * speedCoef / s.resampleCoef
+
+				// 古いピッチマークを破棄
+				if 2 < m {
+					marks = append([]psolaMark{}, marks[m-1:]...)
+					m = 1
+				}
+			}
+		}
+
+		for shape := range s.input {
+			t0 := time.Now()
+			marks = append(marks, psolaMark{pos: pos, shape: shape})
+			pos += len(shape.Data())
+			synthesize(false)
+			// 出力先の待ち時間は含めない
+			busy += time.Since(t0)
+			// 以降の素片が重ならない位置までを出力
+			if until := int(synth) - maxHalf; s.minChunkLen <= until-outBase {
+				emit(until)
+			}
+		}
+		if 0 < len(marks) {
+			synthesize(true)
+			emit(outBase + len(out))
+		}
+		log.Printf("debug: stretcher %d messages (psola, %s busy)", msg, busy)
+		close(s.output)
+	}()
+}
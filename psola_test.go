@@ -0,0 +1,47 @@
+package voispire
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStretcher_psolaIdentity(t *testing.T) {
+	const fs = 8000
+	// 周期が少しずつ変化する、任意の波形の周期の列
+	r := rand.New(rand.NewSource(1))
+	input := make(chan buffer.Shape, 256)
+	src := []float64{}
+	for i := 0; i < 200; i++ {
+		period := 60 + i%25
+		shape := make([]float64, period)
+		for j := range shape {
+			shape[j] = r.Float64()*2 - 1
+		}
+		src = append(src, shape...)
+		input <- buffer.MakeShape(shape)
+	}
+	close(input)
+
+	s := newStretcher(control.Const(1), control.Const(1), 1, fs)
+	s.engine = "psola"
+	s.input = input
+	s.Start()
+	result := []float64{}
+	for shape := range s.output {
+		result = append(result, shape.Data()...)
+	}
+
+	// ピッチ係数・速度係数が 1 のとき、隣り合う素片の窓の和が 1 となり、入力がそのまま再構成される
+	// （最初と最後の周期は片側の素片しか重ならないため除く）
+	assert.True(t, len(src) <= len(result), "len(src)=%d len(result)=%d", len(src), len(result))
+	maxErr := .0
+	for i := 100; i < len(src)-100; i++ {
+		maxErr = math.Max(maxErr, math.Abs(result[i]-src[i]))
+	}
+	assert.True(t, maxErr < 1e-9, "error=%g", maxErr)
+}
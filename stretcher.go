@@ -2,32 +2,58 @@ package voispire
 
 import (
 	"log"
+	"time"
 
 	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/control"
 )
 
+// pitchTau は、ピッチ係数の変更に追従する時定数 [sec] です。
+const pitchTau = .03
+
 // stretcher は、指定したピッチ係数 pitchCoef、速度係数 speedCoef で再生した波形を返します。
 // pitchCoef, speedCoef, resampleCoef がすべて 1 のとき、オリジナルと同じ波形となります。
+// pitchCoef, speedCoef は変換中に変化してもよく、 pitchCoef は周期ごとに滑らかに補間されます。
+// engine に "psola" を指定すると、sinc関数による周期間の補間の代わりにTD-PSOLAを用います。
 type stretcher struct {
 	output       chan buffer.Shape
 	input        <-chan buffer.Shape
-	pitchCoef    float64
-	speedCoef    float64
+	pitchCoef    control.Param
+	speedCoef    control.Param
 	resampleCoef float64
+	fs           float64
 	minChunkLen  int
+	engine       string
+	// contour は、 pitchCoef に含まれる成分のうち、入力の基本周波数の軌跡に追従して周期ごとに変化する成分です。
+	// pitchCoef のうちこの成分は平滑化せずに適用します。
+	contour control.Param
+	// gain は、周期ごとにかける振幅の倍率です。
+	gain control.Param
+	// transient は、入力の時刻 t [sec] の周期が過渡音かどうかを返します。
+	// nil でない場合、過渡音の周期は繰り返したり間引いたりせず、元の高さ・速さのまま出力します。
+	transient func(t float64) bool
+	// latency は、入力に対する出力の遅延 [入力サンプル] です。最初の出力以降に有効となります。
+	latency int
 }
 
-func newStretcher(pitchCoef, speedCoef, resampleCoef float64) *stretcher {
+func newStretcher(pitchCoef, speedCoef control.Param, resampleCoef, fs float64) *stretcher {
 	return &stretcher{
 		output:       make(chan buffer.Shape, 16),
 		pitchCoef:    pitchCoef,
 		speedCoef:    speedCoef,
 		resampleCoef: resampleCoef,
+		fs:           fs,
 		minChunkLen:  1024,
+		contour:      control.Const(1),
+		gain:         control.Const(1),
 	}
 }
 
 func (s *stretcher) Start() {
+	if s.engine == "psola" {
+		s.startPSOLA()
+		return
+	}
 	history := &buffer.ShapeHistory{}
 	go func() {
 		log.Print("debug: stretcher goroutine is started")
@@ -35,32 +61,58 @@ func (s *stretcher) Start() {
 		dstPhase := .0
 		result := []float64{}
 		msg := 0
+		t := .0
+		first := true
+		smoother := control.NewSmoother(pitchTau, 0)
+		starts := []float64{} // 履歴の中心から最新までの各周期の開始時刻 [sec]
+		var busy time.Duration
 		for shape := range s.input {
+			t0 := time.Now()
+			if first {
+				s.latency = history.Lag() * len(shape.Data())
+				first = false
+			}
 			history.Rotate(shape)
+			starts = append(starts, t)
+			if history.Lag() < len(starts)-1 {
+				starts = starts[1:]
+			}
 			freq := history.Freq()
-			srcPhaseStep := freq * s.pitchCoef / s.resampleCoef
-			dstPhaseStep := freq * s.speedCoef / s.resampleCoef
+			contour := s.contour.At(t)
+			pitchCoef := smoother.NextAfter(s.pitchCoef.At(t)/contour, 1/(freq*s.fs)) * contour
+			speedCoef := s.speedCoef.At(t)
+			if s.transient != nil && s.transient(starts[0]) {
+				// 補間に使う前後の周期と位相をずらさず、履歴の中心の周期をそのまま出力する
+				pitchCoef, speedCoef = 1, 1
+				srcPhase = dstPhase
+			}
+			gain := s.gain.At(t)
+			t += float64(len(shape.Data())) / s.fs
+			srcPhaseStep := freq * pitchCoef / s.resampleCoef
+			dstPhaseStep := freq * speedCoef / s.resampleCoef
 			for ; dstPhase < 1.0; dstPhase += dstPhaseStep {
-				result = append(result, history.Get(srcPhase, dstPhase))
+				result = append(result, history.Get(srcPhase, dstPhase)*gain)
 				srcPhase += srcPhaseStep
 				for 1.0 <= srcPhase {
 					srcPhase -= 1.0
 				}
 			}
+			for 1.0 <= dstPhase {
+				dstPhase -= 1.0
+			}
+			// 出力先の待ち時間は含めない
+			busy += time.Since(t0)
 			if s.minChunkLen <= len(result) {
 				s.output <- buffer.MakeShape(result)
 				msg++
 				result = []float64{}
 			}
-			for 1.0 <= dstPhase {
-				dstPhase -= 1.0
-			}
 		}
 		if 0 < len(result) {
 			s.output <- buffer.MakeShape(result)
 			msg++
 		}
-		log.Printf("debug: stretcher %d messages", msg)
+		log.Printf("debug: stretcher %d messages (sinc, %s busy)", msg, busy)
 		close(s.output)
 	}()
 }
@@ -0,0 +1,71 @@
+package voispire
+
+import (
+	"log"
+	"math"
+
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/f0track"
+	"github.com/but80/voispire/internal/fft"
+	"github.com/but80/voispire/internal/formant"
+	"github.com/but80/voispire/internal/wav"
+	"github.com/but80/voispire/internal/world"
+	"golang.org/x/xerrors"
+)
+
+// voiceProfile は、話者の平均的な声質です。
+type voiceProfile struct {
+	fs        int
+	envelope  []float64 // 有声フレームにおける包絡線の対数振幅の平均
+	logF0Mean float64   // 有声フレームにおける基本周波数の自然対数の平均
+	logF0Std  float64   // 有声フレームにおける基本周波数の自然対数の標準偏差
+}
+
+// analyzeVoice は、波形 wave とその基本周波数 f0 から話者の平均的な声質を分析します。
+func analyzeVoice(wave []float64, fs int, f0 *f0track.Track, config fft.Config, o formant.EnvelopeOptions) (*voiceProfile, error) {
+	mean, std, ok := f0.LogStats()
+	if !ok {
+		return nil, xerrors.New("有声区間がありません")
+	}
+	o.F0 = control.Func(f0.Freq)
+	envelope := formant.AverageEnvelope(wave, fs, config, o)
+	if envelope == nil {
+		return nil, xerrors.New("有声区間が短すぎます")
+	}
+	return &voiceProfile{
+		fs:        fs,
+		envelope:  envelope,
+		logF0Mean: mean,
+		logF0Std:  std,
+	}, nil
+}
+
+// loadVoice は、音声ファイル filename を読み込んで話者の平均的な声質を分析します。
+func loadVoice(filename string, framePeriodMsec float64, config fft.Config, o formant.EnvelopeOptions) (*voiceProfile, error) {
+	wave, fs, err := wav.Load(filename)
+	if err != nil {
+		return nil, xerrors.Errorf("音声ファイルの読み込みに失敗しました: %w", err)
+	}
+	f0 := f0track.FromHarvest(world.Harvest(wave, fs, framePeriodMsec, f0Floor, f0Ceil))
+	return analyzeVoice(wave, fs, f0, config, o)
+}
+
+// f0Mapping は、基本周波数の対数の平均と標準偏差を from から to に合わせる関数を返します。
+func (from *voiceProfile) f0Mapping(to *voiceProfile) func(t, f0 float64) float64 {
+	scale := 1.0
+	if 0 < from.logF0Std {
+		scale = to.logF0Std / from.logF0Std
+	}
+	log.Printf(
+		"info: 基本周波数の平均 %.1f Hz → %.1f Hz, 変動幅 x%.2f",
+		math.Exp(from.logF0Mean), math.Exp(to.logF0Mean), scale,
+	)
+	return func(t, f0 float64) float64 {
+		return math.Exp(to.logF0Mean + (math.Log(f0)-from.logF0Mean)*scale)
+	}
+}
+
+// envelopeMapping は、平均包絡線を from から to に近づける補正を返します。
+func (from *voiceProfile) envelopeMapping(to *voiceProfile) *formant.EnvelopeMapping {
+	return formant.NewEnvelopeMapping(from.envelope, from.fs, to.envelope, to.fs)
+}
@@ -0,0 +1,78 @@
+package voispire
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/but80/voispire/internal/fft"
+)
+
+const (
+	// transientBefore, transientAfter は、検出したオンセットの前後で過渡音として扱う区間の長さ [sec] です。
+	// オンセットの位置はフォルマントシフタのフレームをずらす幅の精度でしか分からないため、後方を長めに取ります。
+	transientBefore = .005
+	transientAfter  = .03
+	// transientSplitFreq は、基本周波数が分からないときに、周波数スペクトルから無声音かどうかを判定する境界の周波数 [Hz] です。
+	// 破裂音・摩擦音はエネルギーの大半がこれより高域にあります。
+	transientSplitFreq = 2000.0
+)
+
+// transients は、フォルマントシフタが検出したオンセットのうち、無声の過渡音の時刻を記録します。
+type transients struct {
+	fs     float64
+	config fft.Config
+	// f0 は、入力の時刻 t [sec] における基本周波数 [Hz] を返します（不明なときは 0）。
+	// nil のときは周波数スペクトルから無声音かどうかを判定します。
+	f0    func(t float64) float64
+	times []float64 // 昇順
+	mutex sync.Mutex
+}
+
+func newTransients(fs int, config fft.Config, f0 func(t float64) float64) *transients {
+	return &transients{fs: float64(fs), config: config, f0: f0}
+}
+
+// unvoiced は、入力の位置 i [サンプル] のオンセットが無声音かどうかを、そのフレームの周波数スペクトル spec から判定します。
+// 有声音の立ち上がりでフォルマントシフトを省くとフォルマントが飛ぶため、加工を省くフレームの範囲全体が無声である必要があります。
+func (tr *transients) unvoiced(i int, spec []complex128) bool {
+	if tr.f0 != nil {
+		step := tr.config.Step()
+		for j := i - tr.config.Width + step; j < i+tr.config.Width; j += step {
+			if 0 < tr.f0(float64(j)/tr.fs) {
+				return false
+			}
+		}
+		return true
+	}
+	split := int(transientSplitFreq * float64(2*(len(spec)-1)) / tr.fs)
+	low, high := .0, .0
+	for k, c := range spec {
+		p := real(c)*real(c) + imag(c)*imag(c)
+		if k < split {
+			low += p
+		} else {
+			high += p
+		}
+	}
+	return low < high
+}
+
+// add は、入力の位置 i [サンプル] のオンセットが無声音であれば記録し、true を返します。
+// spec はオンセットを検出したフレームの周波数スペクトルです。
+func (tr *transients) add(i int, spec []complex128) bool {
+	if !tr.unvoiced(i, spec) {
+		return false
+	}
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.times = append(tr.times, float64(i)/tr.fs)
+	return true
+}
+
+// near は、時刻 t [sec] が過渡音の区間に含まれるかどうかを返します。
+func (tr *transients) near(t float64) bool {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	i := sort.SearchFloat64s(tr.times, t-transientAfter)
+	return i < len(tr.times) && tr.times[i] <= t+transientBefore
+}
@@ -0,0 +1,99 @@
+package voispire
+
+import (
+	"math"
+
+	"github.com/but80/voispire/internal/f0track"
+)
+
+const (
+	// vibratoFadeTime は、ビブラートの開始後に深さが最大になるまでの時間 [sec] です。
+	vibratoFadeTime = .3
+	// vibratoSmoothTime は、既存のビブラートを抑えるために基本周波数を移動平均する区間の長さ [sec] です。
+	// 一般的なビブラートの1周期（5..7Hz）より長くします。
+	vibratoSmoothTime = .25
+	// jitterTime は、ジッタ・シマーの値を切り替える間隔 [sec] です。
+	// 値は周期ではなく時刻で区切って決めるため、基本周期がこれより短い場合は連続する周期で同じ値となります。
+	jitterTime = .005
+)
+
+// pitchModulation は、歌声向けに基本周波数の軌跡にビブラートやジッタを加えたり、既存のビブラートを抑えたりします。
+// 時刻はすべて入力の時刻 [sec] です。
+type pitchModulation struct {
+	track     *f0track.Track // 入力の基本周波数
+	smoothed  *f0track.Track // 移動平均した入力の基本周波数
+	reduction float64        // 既存のビブラートを抑える割合 (0..1)
+	rate      float64        // 加えるビブラートの周期 [Hz]
+	depth     float64        // 加えるビブラートの深さ [cent]
+	delay     float64        // 有声区間の開始からビブラートを始めるまでの時間 [sec]
+	jitter    float64        // jitterTime ごとに変える基本周波数の揺らぎの大きさ（比率）
+	shimmer   float64        // jitterTime ごとに変える振幅の揺らぎの大きさ [dB]
+}
+
+// newPitchModulation は、オプションで指定された pitchModulation を作成します。何も指定されていない場合は nil を返します。
+func newPitchModulation(o Options, track *f0track.Track) *pitchModulation {
+	if o.VibratoDepth <= 0 && o.VibratoReduction <= 0 && o.Jitter <= 0 && o.Shimmer <= 0 {
+		return nil
+	}
+	m := &pitchModulation{
+		track:     track,
+		reduction: o.VibratoReduction,
+		rate:      o.VibratoRate,
+		depth:     o.VibratoDepth,
+		delay:     o.VibratoDelayMsec / 1000,
+		jitter:    o.Jitter / 100,
+		shimmer:   o.Shimmer,
+	}
+	if 0 < m.reduction {
+		m.smoothed = track.Smooth(vibratoSmoothTime)
+	}
+	return m
+}
+
+// noise は、整数 i に対して決まる -1..1 の擬似乱数を返します。
+// 同じ時刻に対して常に同じ値を返すよう、乱数生成器の状態を持たずにハッシュ（SplitMix64）で求めます。
+func noise(i int64, seed uint64) float64 {
+	z := uint64(i)*0x9e3779b97f4a7c15 + seed
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return float64(z>>11)/float64(1<<53)*2 - 1
+}
+
+// flatten は、時刻 t における入力の基本周波数 f0 [Hz] から、既存のビブラートを抑えた基本周波数を返します。
+func (m *pitchModulation) flatten(t, f0 float64) float64 {
+	if m.reduction <= 0 {
+		return f0
+	}
+	smoothed := m.smoothed.Freq(t)
+	if smoothed <= 0 {
+		return f0
+	}
+	return math.Exp(math.Log(f0)*(1-m.reduction) + math.Log(smoothed)*m.reduction)
+}
+
+// modulate は、時刻 t における変更後の基本周波数 f0 [Hz] にビブラートとジッタを加えた基本周波数を返します。
+func (m *pitchModulation) modulate(t, f0 float64) float64 {
+	cents := .0
+	if 0 < m.depth {
+		if onset, ok := m.track.Onset(t); ok {
+			if u := t - onset - m.delay; 0 < u {
+				fade := math.Min(1, u/vibratoFadeTime)
+				cents += m.depth * fade * math.Sin(2*math.Pi*m.rate*u)
+			}
+		}
+	}
+	ratio := math.Pow(2, cents/1200)
+	if 0 < m.jitter {
+		ratio *= 1 + m.jitter*noise(int64(t/jitterTime), 1)
+	}
+	return f0 * ratio
+}
+
+// gain は、時刻 t における振幅の倍率（シマー）を返します。値は jitterTime ごとに変わります。
+func (m *pitchModulation) gain(t float64) float64 {
+	if m.shimmer <= 0 || m.track.Freq(t) <= 0 {
+		return 1
+	}
+	return math.Pow(10, m.shimmer*noise(int64(t/jitterTime), 2)/20)
+}
@@ -0,0 +1,103 @@
+package voispire
+
+import (
+	"math"
+	"testing"
+
+	"github.com/but80/voispire/internal/f0track"
+	"github.com/stretchr/testify/assert"
+)
+
+// vibratoTrack は、0.5秒まで無声、以降2秒まで 200Hz を中心に 6Hz・±50cent のビブラートがかかった基本周波数の系列を返します。
+func vibratoTrack() *f0track.Track {
+	times := []float64{}
+	values := []float64{}
+	for i := 0; i <= 400; i++ {
+		t := float64(i) / 200
+		times = append(times, t)
+		if t < .5 {
+			values = append(values, 0)
+			continue
+		}
+		values = append(values, 200*math.Pow(2, 50*math.Sin(2*math.Pi*6*t)/1200))
+	}
+	return f0track.New(times, values)
+}
+
+func cents(a, b float64) float64 {
+	return 1200 * math.Log2(a/b)
+}
+
+func TestNewPitchModulation(t *testing.T) {
+	assert.Nil(t, newPitchModulation(Options{VibratoRate: 5}, vibratoTrack()))
+	assert.NotNil(t, newPitchModulation(Options{VibratoDepth: 50}, vibratoTrack()))
+	assert.NotNil(t, newPitchModulation(Options{Shimmer: 1}, vibratoTrack()))
+}
+
+func TestPitchModulation_modulate_vibrato(t *testing.T) {
+	m := &pitchModulation{track: vibratoTrack(), rate: 5, depth: 100, delay: .2}
+	tests := []struct {
+		name  string
+		t     float64
+		cents float64
+	}{
+		{"unvoiced", .3, 0},
+		{"before the delay", .5 + .1, 0},
+		// 開始直後は深さが徐々に大きくなる（5Hz の 1/4 周期で正の頂点）
+		{"fading in", .5 + .2 + .05, 100 * .05 / vibratoFadeTime},
+		// フェードを終えると指定の深さとなる（5Hz の 7/4 周期で負の頂点）
+		{"full depth", .5 + .2 + .35, -100},
+	}
+	for _, tt := range tests {
+		assert.InDelta(t, tt.cents, cents(m.modulate(tt.t, 200), 200), 1e-6, tt.name)
+	}
+}
+
+func TestPitchModulation_flatten(t *testing.T) {
+	track := vibratoTrack()
+	// maxDeviation は、有声区間の中ほどにおける、平滑化した基本周波数からの最大のずれ [cent] を返します。
+	maxDeviation := func(reduction float64) float64 {
+		m := newPitchModulation(Options{VibratoReduction: reduction}, track)
+		d := .0
+		for t := 1.0; t < 1.5; t += .001 {
+			d = math.Max(d, math.Abs(cents(m.flatten(t, track.Freq(t)), m.smoothed.Freq(t))))
+		}
+		return d
+	}
+	// 抑える割合に比例して、平滑化した基本周波数からのずれが小さくなる
+	none := maxDeviation(1e-9)
+	assert.True(t, 40 < none, "none=%f", none)
+	assert.InDelta(t, none/2, maxDeviation(.5), 1e-6)
+	assert.InDelta(t, 0, maxDeviation(1), 1e-6)
+
+	// 対数上で入力と平滑化した基本周波数を比率に応じて混ぜる
+	m := newPitchModulation(Options{VibratoReduction: .25}, track)
+	f0 := track.Freq(1.1)
+	smoothed := m.smoothed.Freq(1.1)
+	assert.InDelta(t, math.Pow(f0, .75)*math.Pow(smoothed, .25), m.flatten(1.1, f0), 1e-9)
+	// 無声の時刻や、抑えない場合はそのまま
+	assert.Equal(t, 150.0, m.flatten(.3, 150))
+	assert.Equal(t, f0, (&pitchModulation{track: track}).flatten(1.1, f0))
+}
+
+func TestPitchModulation_jitterShimmer(t *testing.T) {
+	m := &pitchModulation{track: vibratoTrack(), jitter: .02, shimmer: 1}
+	seen := map[float64]bool{}
+	for i := 0; i < 100; i++ {
+		t0 := 1 + (float64(i)+.25)*jitterTime // 区間の境界を避ける
+		f := m.modulate(t0, 200)
+		// 同じ区間では常に同じ値となる
+		assert.Equal(t, f, m.modulate(t0+jitterTime/2, 200))
+		assert.Equal(t, f, m.modulate(t0, 200))
+		assert.True(t, math.Abs(f/200-1) <= m.jitter, "f=%f", f)
+		seen[f] = true
+
+		g := m.gain(t0)
+		assert.Equal(t, g, m.gain(t0))
+		assert.True(t, math.Abs(20*math.Log10(g)) <= m.shimmer, "gain=%f", g)
+	}
+	// 区間ごとに値が変わる
+	assert.True(t, 90 < len(seen), "distinct=%d", len(seen))
+	// 無声の時刻では振幅を変えない
+	assert.Equal(t, 1.0, m.gain(.3))
+}
@@ -2,10 +2,14 @@ package voispire
 
 import (
 	"log"
-	"math"
 	"time"
 
 	"github.com/but80/voispire/internal/buffer"
+	"github.com/but80/voispire/internal/carrier"
+	"github.com/but80/voispire/internal/control"
+	"github.com/but80/voispire/internal/denoise"
+	"github.com/but80/voispire/internal/f0track"
+	"github.com/but80/voispire/internal/fft"
 	"github.com/but80/voispire/internal/formant"
 	"github.com/but80/voispire/internal/wav"
 	"github.com/but80/voispire/internal/world"
@@ -21,14 +25,62 @@ const (
 
 // Options は、 Start 関数のオプションです。
 type Options struct {
-	Formant         float64
-	Transpose       float64
-	FramePeriodMsec float64
-	Rate            int
-	InDevID         int
-	OutDevID        int
-	InFile          string
-	OutFile         string
+	Formant            float64
+	Tilt               float64
+	Transpose          float64
+	FramePeriodMsec    float64
+	Rate               int
+	InDevID            int
+	OutDevID           int
+	InFile             string
+	OutFile            string
+	ControlStdin       bool
+	ControlAddr        string
+	OSCAddr            string
+	MIDIPort           string
+	Harmony            []Voice
+	Mix                float64
+	Gain               float64
+	Limit              bool
+	GateThreshold      float64
+	GateAttackMsec     float64
+	GateReleaseMsec    float64
+	GateVoicing        bool
+	PitchMarks         string
+	PitchEngine        string
+	FFTSize            int
+	FFTOverlap         int
+	FFTWindow          string
+	EnvelopeIterations int
+	Envelope           string
+	Warp               string
+	Smoothing          string
+	SmoothingTauMsec   float64
+	LowCutoff          float64
+	LowCutoffF0        bool
+	TargetVoice        string
+	MorphFile          string
+	MorphRatio         string
+	Carrier            string
+	CarrierFreq        float64
+	Whisper            bool
+	MonotoneFreq       float64
+	IntonationOffset   float64 // 抑揚の幅の倍率から 1 を引いた値（0 のとき抑揚を変えない）
+	VibratoRate        float64
+	VibratoDepth       float64
+	VibratoDelayMsec   float64
+	VibratoReduction   float64
+	Jitter             float64
+	Shimmer            float64
+	Denoise            string
+	DenoiseAmount      float64
+	DenoiseFloor       float64
+	NoiseProfile       string
+	NoiseLearnMsec     float64
+	EchoCancel         bool
+	EchoReference      string
+	EchoTailMsec       float64
+	Transients         float64
 }
 
 // Start は、音声変換を開始します。
@@ -41,18 +93,122 @@ func Start(o Options) error {
 	return nil
 }
 
+// fftConfig は、オプションで指定されたフレームの設定を返します。省略された項目は既定値とします。
+func fftConfig(o Options) (fft.Config, error) {
+	config := fft.DefaultConfig
+	if 0 < o.FFTSize {
+		config.Width = o.FFTSize
+	}
+	if 0 < o.FFTOverlap {
+		config.Overlap = o.FFTOverlap
+	}
+	if o.FFTWindow != "" {
+		config.Window = o.FFTWindow
+	}
+	if err := config.Validate(); err != nil {
+		return config, xerrors.Errorf("FFTの設定が不正です: %w", err)
+	}
+	return config, nil
+}
+
+// carrierSource は、オプションで指定されたチャンネルボコーダの搬送波を返します。
+// 発振器の周波数は、目標の基本周波数が指定されている間はその周波数とし、それ以外はピッチシフト量に従って変化させます。
+func carrierSource(o Options, ctrl *controller, fs int) (formant.Carrier, error) {
+	if o.Whisper {
+		// 周期的な音源を雑音に置き換える
+		return carrier.NewNoise(), nil
+	}
+	switch o.Carrier {
+	case carrier.Saw, carrier.Square:
+		freq := control.Func(func(t float64) float64 {
+			if note := ctrl.param("note").At(t); 0 < note {
+				return note
+			}
+			return o.CarrierFreq * ctrl.pitchRatio(t)
+		})
+		return carrier.NewOscillator(o.Carrier, freq, fs), nil
+	case "noise":
+		return carrier.NewNoise(), nil
+	}
+	wave, fsWave, err := wav.Load(o.Carrier)
+	if err != nil {
+		return nil, xerrors.Errorf("搬送波の音声ファイルの読み込みに失敗しました: %w", err)
+	}
+	if len(wave) == 0 {
+		return nil, xerrors.New("搬送波の音声ファイルが空です")
+	}
+	return carrier.NewLoop(wave, fsWave, fs), nil
+}
+
 func start(o Options) error {
-	var f0 []float64
-	if o.Transpose != 0 {
-		log.Print("info: 基本周波数を推定中...")
+	fftConf, err := fftConfig(o)
+	if err != nil {
+		return err
+	}
+
+	// 位相ボコーダ以外のピッチシフトには入力ファイルから推定した基本周波数が必要
+	// チャンネルボコーダでは、出力のピッチは搬送波で決まる
+	useVocoder := o.PitchEngine == "vocoder"
+	useCarrier := o.Carrier != "" || o.Whisper
+	if useCarrier && (useVocoder || 0 < len(o.Harmony) || o.TargetVoice != "" || o.MorphFile != "") {
+		return xerrors.New("チャンネルボコーダ・ささやき声は、位相ボコーダ・ハーモニー・目標の話者・モーフィングとは併用できません")
+	}
+	if 0 < o.MonotoneFreq && (useVocoder || useCarrier || o.InFile == "") {
+		return xerrors.New("単調なピッチは、位相ボコーダ以外のピッチシフトで入力ファイルを変換する場合のみ有効です")
+	}
+	useModulation := 0 < o.VibratoDepth || 0 < o.VibratoReduction || 0 < o.Jitter || 0 < o.Shimmer
+	useContour := 0 < o.MonotoneFreq || o.IntonationOffset != 0 || o.TargetVoice != "" || o.MorphFile != "" || useModulation
+	if (o.IntonationOffset != 0 || useModulation) && (useVocoder || useCarrier || o.InFile == "") {
+		return xerrors.New("抑揚の幅・ビブラート等の変更は、位相ボコーダ以外のピッチシフトで入力ファイルを変換する場合のみ有効です")
+	}
+	// オーディオデバイスからの入力では、MIDIのノートに合わせるために基本周波数を逐次推定する
+	usePitch := !useVocoder && !useCarrier && (o.Transpose != 0 || o.MIDIPort != "" || (0 < len(o.Harmony) || useContour) && o.InFile != "")
+	if o.TargetVoice != "" && (useVocoder || o.InFile == "") {
+		return xerrors.New("目標の話者の指定は、位相ボコーダ以外のピッチシフトで入力ファイルを変換する場合のみ有効です")
+	}
+	if o.MorphFile != "" && (useVocoder || o.InFile == "" || o.TargetVoice != "" || 0 < len(o.Harmony)) {
+		return xerrors.New("モーフィングは、位相ボコーダ以外のピッチシフトで入力ファイルを変換する場合のみ有効です（目標の話者・ハーモニーとは併用できません）")
+	}
+
+	if 0 < o.Transients && (useVocoder || useCarrier) {
+		return xerrors.New("過渡音の保護は、位相ボコーダ・チャンネルボコーダ・ささやき声とは併用できません")
+	}
+	if o.EchoCancel && o.InFile != "" {
+		return xerrors.New("エコーキャンセラは、オーディオデバイスから入力する場合のみ有効です")
+	}
+	if o.EchoReference != "" && o.InFile == "" {
+		return xerrors.New("エコーの参照信号のファイルは、入力ファイルを変換する場合のみ有効です")
+	}
 
-		src, fs, err := wav.Load(o.InFile)
+	// エコーを除去した入力（参照信号のファイル指定時）
+	var echoCancelled []float64
+	var fsEchoCancelled int
+	if o.EchoReference != "" {
+		var err error
+		echoCancelled, fsEchoCancelled, err = cancelEchoFile(o)
 		if err != nil {
-			return xerrors.Errorf("音声ファイルの読み込みに失敗しました: %w", err)
+			return err
+		}
+	}
+
+	var f0 *f0track.Track
+	var src []float64
+	if usePitch && o.InFile != "" {
+		log.Print("info: 基本周波数を推定中...")
+
+		var fs int
+		if echoCancelled != nil {
+			src, fs = echoCancelled, fsEchoCancelled
+		} else {
+			var err error
+			src, fs, err = wav.Load(o.InFile)
+			if err != nil {
+				return xerrors.Errorf("音声ファイルの読み込みに失敗しました: %w", err)
+			}
 		}
 		log.Printf("debug: IN: %d samples, fs=%d", len(src), fs)
 
-		f0, _ = world.Harvest(src, fs, o.FramePeriodMsec, f0Floor, f0Ceil)
+		f0 = f0track.FromHarvest(world.Harvest(src, fs, o.FramePeriodMsec, f0Floor, f0Ceil))
 	}
 
 	// 入力ファイルのみ指定時
@@ -85,6 +241,11 @@ func start(o Options) error {
 		input = audioInput
 		// FIXME: 入力デバイスの周波数レートをfsに設定
 		fs = 44100
+	} else if echoCancelled != nil {
+		input = buffer.NewWaveSource()
+		input.Append(echoCancelled)
+		input.Close()
+		fs = fsEchoCancelled
 	} else {
 		var err error
 		input, fs, err = wav.NewWavFileSource(o.InFile)
@@ -97,41 +258,251 @@ func start(o Options) error {
 		input.Close()
 	})
 
+	if o.Denoise != "" {
+		log.Print("info: 雑音除去を使用します")
+		dnOpts := denoise.Options{
+			Method:    o.Denoise,
+			Amount:    o.DenoiseAmount,
+			Floor:     o.DenoiseFloor,
+			LearnTime: o.NoiseLearnMsec / 1000,
+		}
+		if o.NoiseProfile != "" {
+			wave, fsNoise, err := wav.Load(o.NoiseProfile)
+			if err != nil {
+				return xerrors.Errorf("雑音の音声ファイルの読み込みに失敗しました: %w", err)
+			}
+			dnOpts.Profile = denoise.LearnProfile(wave, fsNoise, fs, fftConf)
+			if dnOpts.Profile == nil {
+				return xerrors.New("雑音の音声ファイルが短すぎます")
+			}
+		} else {
+			log.Printf("info: 先頭の %.0f msec から雑音を学習します", o.NoiseLearnMsec)
+		}
+		dn := denoise.New(input, fs, fftConf, dnOpts)
+		input = feedWaveSource(dn.Output())
+		dn.Start()
+	}
+
 	fsOut := fs
 	if 0 < o.Rate {
 		fsOut = o.Rate
 	}
 
-	pitchCoef := math.Pow(2.0, o.Transpose/12.0)
-	formantCoef := math.Pow(2.0, (o.Formant-o.Transpose)/12.0)
+	var live *liveF0
+	if usePitch && f0 == nil {
+		log.Print("info: 基本周波数を入力から逐次推定します")
+		live = newLiveF0(float64(fs))
+	}
 
-	mod1 := formant.NewCepstralShifter(input, fs, 1024, formantCoef)
+	ctrl := newController(o, usePitch || useVocoder || useCarrier)
+	// 位相ボコーダでは入力の基本周波数を推定しないため、ノートの音高に合わせる比率を求められない
+	ctrl.noteEnabled = f0 != nil || live != nil || useCarrier
+	if live != nil {
+		ctrl.f0 = live.Freq
+	}
+	if f0 != nil {
+		ctrl.f0 = f0.Freq
+		if mean, _, ok := f0.LogStats(); ok {
+			ctrl.logF0Mean = mean
+		}
+		ctrl.modulation = newPitchModulation(o, f0)
+	}
+	if err := ctrl.listen(o); err != nil {
+		return err
+	}
+	if o.MIDIPort != "" {
+		if err := ctrl.listenMIDI(o.MIDIPort); err != nil {
+			return err
+		}
+	}
+
+	var vad *noiseGate
+	if o.GateThreshold != 0 {
+		log.Print("info: ノイズゲートを使用します")
+		vad = newNoiseGate(input, fs, o)
+		// 逐次推定ではノイズゲートの判定時点で基本周波数が得られないため、自己相関で判定する
+		if f0 != nil {
+			vad.f0 = ctrl.f0
+		}
+		f0 := ctrl.f0
+		ctrl.f0 = func(t float64) float64 {
+			if !vad.active(t) {
+				return 0
+			}
+			return f0(t)
+		}
+		input = vad.output
+		vad.Start()
+	}
+
+	useMixer := o.Mix != 1 || o.Gain != 0 || o.Limit || isLive(o)
+	var dry *buffer.WaveSource
+	if useMixer {
+		dry = input.Tee()
+	}
+
+	warp, err := formant.ParseWarp(o.Warp)
+	if err != nil {
+		return xerrors.Errorf("周波数軸の伸縮方法が不正です: %w", err)
+	}
+	envOpts := formant.EnvelopeOptions{
+		Method:       o.Envelope,
+		Iterations:   o.EnvelopeIterations,
+		Warp:         warp,
+		Smoothing:    o.Smoothing,
+		SmoothingTau: o.SmoothingTauMsec / 1000,
+		LowCutoff:    o.LowCutoff,
+		LowCutoffF0:  o.LowCutoffF0,
+		Tilt:         ctrl.tiltCoef(),
+	}
+	if usePitch {
+		envOpts.F0 = control.Func(ctrl.f0)
+	}
+	if o.TargetVoice != "" {
+		log.Print("info: 声質を分析中...")
+		from, err := analyzeVoice(src, fs, f0, fftConf, envOpts)
+		if err != nil {
+			return xerrors.Errorf("入力の声質の分析に失敗しました: %w", err)
+		}
+		to, err := loadVoice(o.TargetVoice, o.FramePeriodMsec, fftConf, envOpts)
+		if err != nil {
+			return xerrors.Errorf("目標の話者の声質の分析に失敗しました: %w", err)
+		}
+		ctrl.f0Map = from.f0Mapping(to)
+		envOpts.Mapping = from.envelopeMapping(to)
+		envOpts.Mapping.Scale = ctrl.pitchCoef()
+	}
+	speed := control.Param(control.Const(1))
+	if o.MorphFile != "" {
+		log.Print("info: モーフィングの対応付けを計算中...")
+		ratio, err := control.ParseCurve(o.MorphRatio)
+		if err != nil {
+			return xerrors.Errorf("モーフィングの比率が不正です: %w", err)
+		}
+		m, err := loadMorph(o.MorphFile, src, f0, fs, o.FramePeriodMsec, fftConf, envOpts, ratio)
+		if err != nil {
+			return xerrors.Errorf("モーフィングの対応付けに失敗しました: %w", err)
+		}
+		ctrl.f0Map = m.f0Map
+		envOpts.Mapping = m.envelopeMapping()
+		envOpts.Mapping.Scale = ctrl.pitchCoef()
+		speed = control.Func(m.speed)
+	}
+	var mod1 formant.FormantShifter
+	if useCarrier {
+		carrier, err := carrierSource(o, ctrl, fs)
+		if err != nil {
+			return err
+		}
+		mod1 = formant.NewChannelVocoder(input, fs, fftConf, envOpts, carrier, control.Func(ctrl.formantRatio))
+	} else if useVocoder {
+		mod1 = formant.NewPhaseVocoder(input, fs, fftConf, envOpts, ctrl.pitchCoef(), control.Func(ctrl.formantRatio))
+	} else {
+		// ストレッチャによるフォルマントのずれは、フォルマントシフタで打ち消す
+		shiftOpts := envOpts
+		shiftOpts.OutputScale = ctrl.pitchCoef()
+		mod1 = formant.NewShifter(input, fs, fftConf, shiftOpts, control.Func(ctrl.formantRatio))
+	}
+	var trans *transients
+	if 0 < o.Transients {
+		log.Print("info: 過渡音を保護します")
+		var voicing func(t float64) float64
+		if usePitch {
+			voicing = ctrl.f0
+		}
+		trans = newTransients(fs, fftConf, voicing)
+		mod1.PreserveTransients(o.Transients, trans.add)
+	}
 	var mod2 *f0Splitter
-	var mod3 *stretcher
+	var stretchers []*stretcher
 	var lastmod interface{ Start() }
 	var outCh <-chan float64
-	if o.Transpose == 0 {
+	outChannels := 1
+	if useCarrier {
+		if o.Whisper {
+			log.Print("info: ささやき声に変換します")
+		} else {
+			log.Print("info: チャンネルボコーダを使用します")
+		}
+		outCh = mod1.Output()
+		lastmod = mod1
+	} else if useVocoder {
+		log.Print("info: 位相ボコーダを使用します")
+		outCh = mod1.Output()
+		lastmod = mod1
+	} else if !usePitch {
 		log.Print("info: フォルマントシフタのみを使用します")
 		outCh = mod1.Output()
 		lastmod = mod1
-	} else {
+	} else if len(o.Harmony) == 0 {
 		log.Print("info: フォルマントシフタとストレッチャを使用します")
-		mod2 = newF0Splitter(f0, float64(fs), o.FramePeriodMsec)
-		mod3 = newStretcher(pitchCoef, 1.0, float64(fsOut)/float64(fs))
+		mod2 = newF0Splitter(f0, float64(fs), o.PitchMarks != "phase")
+		mod2.live = live
+		if vad != nil {
+			mod2.voiced = vad.active
+		}
+		mod3 := newStretcher(ctrl.pitchCoef(), speed, float64(fsOut)/float64(fs), float64(fs))
 		mod2.input = mod1.Output()
 		mod3.input = mod2.output
 		outCh = join(mod3.output)
 		mod1.Start()
 		mod2.Start()
+		stretchers = append(stretchers, mod3)
+		lastmod = mod3
+	} else {
+		log.Printf("info: フォルマントシフタと %d 声部のストレッチャを使用します", 1+len(o.Harmony))
+		mod2 = newF0Splitter(f0, float64(fs), o.PitchMarks != "phase")
+		mod2.live = live
+		if vad != nil {
+			mod2.voiced = vad.active
+		}
+		mod2.input = mod1.Output()
+		mod3 := newHarmony(mod2.output, o.Harmony, ctrl, fftConf, envOpts, float64(fs), float64(fsOut))
+		outCh = mod3.output
+		outChannels = 2
+		mod1.Start()
+		mod2.Start()
+		stretchers = mod3.stretchers
 		lastmod = mod3
 	}
 
+	for _, st := range stretchers {
+		st.engine = o.PitchEngine
+		if useContour {
+			st.contour = control.Func(ctrl.contourRatio)
+		}
+		if ctrl.modulation != nil {
+			st.gain = control.Func(ctrl.modulation.gain)
+		}
+		if trans != nil {
+			// 有声区間では周期の高さを変えないと音程が途切れるため、無声の過渡音（破裂音等）のみを対象とする
+			// （記録されるオンセットは無声のもののみだが、その後の区間で有声となる周期は除く）
+			st.transient = func(t float64) bool {
+				return trans.near(t) && ctrl.f0(t) <= 0
+			}
+		}
+	}
+
+	var mod4 *mixer
+	if useMixer {
+		log.Print("info: ミキサを使用します")
+		mod4 = newMixer(lastmod, dry, outCh, outChannels, float64(fs), ctrl.param("mix"), o.Gain, o.Limit)
+		if 0 < len(stretchers) {
+			mod4.resampleCoef = float64(fsOut) / float64(fs)
+			mod4.latency = func() int {
+				return stretchers[0].latency
+			}
+		}
+		outCh = mod4.output
+		lastmod = mod4
+	}
+
 	var fileOutCh chan<- []float64
 	var fileOutWait <-chan struct{}
 	waitFileOut := func() {}
 	if o.OutFile != "" {
 		var err error
-		fileOutCh, fileOutWait, err = wav.StartSave(o.OutFile, fsOut)
+		fileOutCh, fileOutWait, err = wav.StartSave(o.OutFile, fsOut, outChannels)
 		if err != nil {
 			return xerrors.Errorf("出力ファイルのオープンに失敗しました: %w", err)
 		}
@@ -147,12 +518,19 @@ func start(o Options) error {
 	}
 
 	if o.InDevID != 0 || o.OutDevID != 0 {
-		waitInput, stream, err := render(params, audioInput, outCh, fileOutCh)
+		echoTail := .0
+		if o.EchoCancel {
+			echoTail = o.EchoTailMsec / 1000
+		}
+		waitInput, stream, err := render(params, audioInput, outCh, outChannels, fileOutCh, echoTail)
 		if err != nil {
 			return xerrors.Errorf("出力ストリームのオープンに失敗しました: %w", err)
 		}
-		if mod3 != nil {
-			mod3.resampleCoef = float64(stream.Info().SampleRate) / float64(fs)
+		for _, st := range stretchers {
+			st.resampleCoef = float64(stream.Info().SampleRate) / float64(fs)
+		}
+		if mod4 != nil && 0 < len(stretchers) {
+			mod4.resampleCoef = float64(stream.Info().SampleRate) / float64(fs)
 		}
 		log.Print("info: 変換を開始しました")
 		go func() {
@@ -0,0 +1,58 @@
+package voispire
+
+import (
+	"testing"
+
+	"github.com/but80/voispire/internal/carrier"
+	"github.com/stretchr/testify/assert"
+)
+
+// countCycles は、のこぎり波の搬送波 c の1秒間の周期の数（負に転じる回数）を返します。
+func countCycles(c interface{ Next(t float64) float64 }, fs int) int {
+	result := 0
+	prev := .0
+	for i := 0; i < fs; i++ {
+		v := c.Next(float64(i) / float64(fs))
+		if 0 < prev && v <= 0 {
+			result++
+		}
+		prev = v
+	}
+	return result
+}
+
+func TestCarrierSource(t *testing.T) {
+	const fs = 8000
+
+	// ささやき声では、搬送波の指定によらず雑音を使用する
+	o := Options{Whisper: true, Carrier: carrier.Saw, CarrierFreq: 100}
+	c, err := carrierSource(o, newController(o, true), fs)
+	assert.NoError(t, err)
+	assert.IsType(t, &carrier.Noise{}, c)
+
+	o = Options{Carrier: "noise"}
+	c, err = carrierSource(o, newController(o, true), fs)
+	assert.NoError(t, err)
+	assert.IsType(t, &carrier.Noise{}, c)
+
+	// 発振器の周波数はピッチシフト量に従う
+	o = Options{Carrier: carrier.Saw, CarrierFreq: 100, Transpose: 12}
+	ctrl := newController(o, true)
+	c, err = carrierSource(o, ctrl, fs)
+	assert.NoError(t, err)
+	assert.IsType(t, &carrier.Oscillator{}, c)
+	assert.InDelta(t, 200, countCycles(c, fs), 1)
+
+	// 目標の基本周波数が指定されている間はその周波数とする
+	ctrl.note.Set(440)
+	assert.InDelta(t, 440, countCycles(c, fs), 1)
+
+	o = Options{Carrier: carrier.Square, CarrierFreq: 100}
+	c, err = carrierSource(o, newController(o, true), fs)
+	assert.NoError(t, err)
+	assert.IsType(t, &carrier.Oscillator{}, c)
+
+	o = Options{Carrier: "/nonexistent.wav"}
+	_, err = carrierSource(o, newController(o, true), fs)
+	assert.Error(t, err)
+}